@@ -2,24 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/sanjain/pixelflow/apps/api/internal/auth"
 	"github.com/sanjain/pixelflow/apps/api/internal/db"
+	"github.com/sanjain/pixelflow/apps/api/internal/handlers"
+	"github.com/sanjain/pixelflow/apps/api/internal/idempotency"
 	"github.com/sanjain/pixelflow/apps/api/internal/kafka"
 	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
 	"github.com/sanjain/pixelflow/apps/api/internal/middleware"
-	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"github.com/sanjain/pixelflow/apps/api/internal/ratelimit"
+	"github.com/sanjain/pixelflow/apps/api/internal/stream"
 	"github.com/sanjain/pixelflow/apps/api/internal/tracing"
+	"github.com/sanjain/pixelflow/apps/api/internal/webhooks"
+	"github.com/sanjain/pixelflow/pkg/outbox"
+	"github.com/sanjain/pixelflow/pkg/storage"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func getEnv(key, fallback string) string {
@@ -40,34 +48,198 @@ func main() {
 
 	// Configuration
 	port := getEnv("PORT", "8080")
-	mongoURL := getEnv("MONGO_URL", "mongodb://localhost:27017")
+	mongoURL := getEnv("MONGO_URL", "mongodb://localhost:27017/?directConnection=true")
 	kafkaBrokers := strings.Split(getEnv("KAFKA_BROKERS", "localhost:9093"), ",")
 	authServiceURL := getEnv("AUTH_SERVICE_URL", "http://localhost:50051")
+	maxUploadBytes, err := strconv.ParseInt(getEnv("MAX_UPLOAD_BYTES", "10485760"), 10, 64) // 10 MB
+	if err != nil {
+		slog.Error("Invalid MAX_UPLOAD_BYTES", "error", err)
+		os.Exit(1)
+	}
+	outboxInterval, err := time.ParseDuration(getEnv("OUTBOX_POLL_INTERVAL", "1s"))
+	if err != nil {
+		slog.Error("Invalid OUTBOX_POLL_INTERVAL", "error", err)
+		os.Exit(1)
+	}
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil {
+		slog.Error("Invalid SHUTDOWN_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+	webhookMaxAttempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "6"))
+	if err != nil {
+		slog.Error("Invalid WEBHOOK_MAX_ATTEMPTS", "error", err)
+		os.Exit(1)
+	}
+	webhookBackoff, err := time.ParseDuration(getEnv("WEBHOOK_RETRY_BACKOFF", "30s"))
+	if err != nil {
+		slog.Error("Invalid WEBHOOK_RETRY_BACKOFF", "error", err)
+		os.Exit(1)
+	}
+	// Only for local development: lets webhooks target localhost and private networks
+	webhookAllowPrivate := getEnv("WEBHOOK_ALLOW_PRIVATE_URLS", "false") == "true"
+	jwksRefresh, err := time.ParseDuration(getEnv("JWKS_REFRESH_INTERVAL", "5m"))
+	if err != nil {
+		slog.Error("Invalid JWKS_REFRESH_INTERVAL", "error", err)
+		os.Exit(1)
+	}
+	revocationCheck := getEnv("AUTH_REVOCATION_CHECK", "false") == "true"
+	revocationCacheTTL, err := time.ParseDuration(getEnv("AUTH_REVOCATION_CACHE_TTL", "30s"))
+	if err != nil {
+		slog.Error("Invalid AUTH_REVOCATION_CACHE_TTL", "error", err)
+		os.Exit(1)
+	}
+	apiKeyCacheTTL, err := time.ParseDuration(getEnv("API_KEY_CACHE_TTL", "30s"))
+	if err != nil {
+		slog.Error("Invalid API_KEY_CACHE_TTL", "error", err)
+		os.Exit(1)
+	}
+	uploadRate, err := strconv.ParseFloat(getEnv("UPLOAD_RATE_PER_MINUTE", "30"), 64)
+	if err != nil {
+		slog.Error("Invalid UPLOAD_RATE_PER_MINUTE", "error", err)
+		os.Exit(1)
+	}
+	uploadBurst, err := strconv.Atoi(getEnv("UPLOAD_RATE_BURST", "10"))
+	if err != nil {
+		slog.Error("Invalid UPLOAD_RATE_BURST", "error", err)
+		os.Exit(1)
+	}
+	dailyQuota, err := strconv.ParseInt(getEnv("TASK_QUOTA_DAILY", "1000"), 10, 64)
+	if err != nil {
+		slog.Error("Invalid TASK_QUOTA_DAILY", "error", err)
+		os.Exit(1)
+	}
+	monthlyQuota, err := strconv.ParseInt(getEnv("TASK_QUOTA_MONTHLY", "10000"), 10, 64)
+	if err != nil {
+		slog.Error("Invalid TASK_QUOTA_MONTHLY", "error", err)
+		os.Exit(1)
+	}
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+	if err != nil {
+		slog.Error("Invalid IDEMPOTENCY_KEY_TTL", "error", err)
+		os.Exit(1)
+	}
+	rateLimitCfg := ratelimit.Config{
+		Backend:  getEnv("RATE_LIMIT_BACKEND", "memory"), // memory or redis
+		RedisURL: getEnv("REDIS_URL", "redis://localhost:6379/0"),
+	}
+
+	// Cancelled on SIGINT/SIGTERM to start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	slog.Info("Starting API Service", "port", port, "kafka_brokers", kafkaBrokers)
 
 	// 1. Initialize MongoDB
 	// Connect to the 'pixelflow' database
 	dbHandler := db.Init(mongoURL, "pixelflow")
-	taskCollection := dbHandler.DB.Collection("tasks")
 	slog.Info("Connected to MongoDB", "db", "pixelflow")
 
 	// 2. Initialize Kafka Producer
 	// Connect to Kafka broker and topic 'image-tasks'
-	kafkaProducer := kafka.NewProducer(kafkaBrokers, "image-tasks")
-	defer kafkaProducer.Close()
+	kafkaProducer := kafka.NewProducer(kafkaBrokers, kafka.TopicImageTasks)
 	slog.Info("Kafka Producer initialized")
 
-	// 3. Initialize Auth Middleware
-	// Connect to Auth Service gRPC server
-	authMiddleware, err := middleware.NewAuthMiddleware(authServiceURL)
+	// Start Outbox Relay
+	// Tasks are written with an outbox message in one transaction; the relay publishes them.
+	// It is stopped only after the HTTP server has drained, so tasks created by in-flight
+	// requests can still be published; anything left stays in the outbox for the next relay.
+	relay := outbox.NewRelay(outbox.New(dbHandler.DB, outbox.DefaultCollection), map[string]outbox.Publisher{
+		kafka.TopicImageTasks: kafkaProducer,
+	}, outboxInterval, outbox.Hooks{
+		Published:     metrics.KafkaMessagesPublishedTotal.Inc,
+		PublishFailed: metrics.KafkaPublishErrorsTotal.Inc,
+		Parked:        metrics.OutboxMessagesParkedTotal.Inc,
+	})
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		relay.Run(relayCtx)
+		close(relayDone)
+	}()
+
+	// Start Webhook Dispatcher
+	// Task lifecycle events from the worker ("task-events") become signed webhook deliveries
+	dispatcher := webhooks.NewDispatcher(dbHandler.DB, 5*time.Second, webhookMaxAttempts, webhookBackoff, webhookAllowPrivate)
+	taskEvents := kafka.NewTaskEventConsumer(kafkaBrokers, "api-webhooks")
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	var webhooksWG sync.WaitGroup
+	webhooksWG.Add(2)
+	go func() {
+		defer webhooksWG.Done()
+		dispatcher.Run(webhooksCtx)
+	}()
+	go func() {
+		defer webhooksWG.Done()
+		taskEvents.Consume(webhooksCtx, dispatcher.Enqueue)
+	}()
+	webhooksDone := make(chan struct{})
+	go func() {
+		webhooksWG.Wait()
+		close(webhooksDone)
+	}()
+
+	// Start Task Stream Hub
+	// One change stream on tasks feeds all SSE clients. It stops on the shutdown signal,
+	// which ends open streams so they do not hold up the HTTP server drain.
+	hub := stream.NewHub(dbHandler.DB)
+	go hub.Run(ctx)
+
+	// 3. Initialize Object Storage
+	// Used for uploaded originals and to sign URLs for processed outputs
+	storageCfg := storage.ConfigFromEnv()
+	blob, err := storage.New(context.Background(), storageCfg)
 	if err != nil {
-		slog.Error("Failed to connect to Auth Service", "error", err)
+		slog.Error("Failed to initialize storage", "backend", storageCfg.Backend, "error", err)
 		os.Exit(1)
 	}
-	slog.Info("Auth Middleware initialized")
+	slog.Info("Object storage initialized", "backend", storageCfg.Backend)
+
+	// 4. Initialize Auth Middleware
+	// Tokens are verified locally with the Auth Service's public keys (JWKS),
+	// which are fetched and refreshed in the background
+	authMiddleware, err := middleware.NewAuthMiddleware(authServiceURL, middleware.AuthConfig{
+		JWKSRefreshInterval: jwksRefresh,
+		RevocationCheck:     revocationCheck,
+		RevocationCacheTTL:  revocationCacheTTL,
+		APIKeyCacheTTL:      apiKeyCacheTTL,
+	})
+	if err != nil {
+		slog.Error("Failed to initialize Auth Middleware", "error", err)
+		os.Exit(1)
+	}
+	go authMiddleware.Run(ctx)
+	slog.Info("Auth Middleware initialized", "revocation_check", revocationCheck)
+
+	// Initialize Rate Limiter
+	// Per-user token bucket and daily/monthly quotas on task creation
+	rateStore, err := ratelimit.New(rateLimitCfg)
+	if err != nil {
+		slog.Error("Failed to initialize rate limit store", "backend", rateLimitCfg.Backend, "error", err)
+		os.Exit(1)
+	}
+	if rs, ok := rateStore.(*ratelimit.RedisStore); ok {
+		// Not fatal: limits fail open until Redis is reachable
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := rs.Ping(pingCtx); err != nil {
+			slog.Warn("Redis is not reachable yet; rate limits are not enforced until it is", "error", err)
+		}
+		cancel()
+		defer rs.Close()
+	}
+	rateLimiter := middleware.NewRateLimiter(rateStore, middleware.RateLimitConfig{
+		RatePerMinute: uploadRate,
+		Burst:         uploadBurst,
+		DailyQuota:    dailyQuota,
+		MonthlyQuota:  monthlyQuota,
+	})
+	slog.Info("Rate limiter initialized", "backend", rateLimitCfg.Backend)
+
+	// Initialize Idempotency Middleware
+	// Retried uploads with the same Idempotency-Key replay the original response
+	idempotent := middleware.NewIdempotency(idempotency.NewStore(dbHandler.DB, idempotencyTTL))
 
-	// 4. Setup Router
+	// 5. Setup Router
 	r := gin.Default() // Use New() to avoid default logger/recovery middleware
 
 	// Add OpenTelemetry Middleware
@@ -81,8 +253,9 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-API-Key, Idempotency-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After, Idempotent-Replayed, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Quota-Daily-Limit, X-Quota-Daily-Remaining, X-Quota-Monthly-Limit, X-Quota-Monthly-Remaining")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -95,6 +268,12 @@ func main() {
 	// Prometheus Metrics Endpoint
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// Signed Object Downloads (local storage backend only)
+	// S3-compatible backends hand out presigned URLs that point at the bucket directly
+	if local, ok := blob.(*storage.Local); ok {
+		r.GET("/files/*key", gin.WrapH(http.StripPrefix("/files", local.Handler())))
+	}
+
 	// Public Health Check
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -102,96 +281,100 @@ func main() {
 
 	// Protected Routes (Require Authentication)
 	// Apply auth middleware to protected routes
+	taskHandler := handlers.NewTaskHandler(dbHandler.DB, relay, blob, maxUploadBytes)
+	webhookHandler := handlers.NewWebhookHandler(dbHandler.DB, webhookAllowPrivate)
+	streamHandler := handlers.NewStreamHandler(hub, taskHandler)
+	// Each route requires the scope for its action; tokens carry the scopes of the user's roles
 	authRoutes := r.Group("/api").Use(authMiddleware.Middleware())
 	{
-		// POST /api/upload - Create a new task
-		authRoutes.POST("/upload", func(c *gin.Context) {
-			// Get UserID from context (set by middleware)
-			userID := c.GetString("userID")
-
-			// Parse request body
-			var req struct {
-				ImageURL string `json:"image_url" binding:"required"`
-			}
-			if err := c.ShouldBindJSON(&req); err != nil {
-				slog.Warn("Upload: Invalid request", "error", err)
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-
-			// Create Task object
-			task := models.Task{
-				ID:          primitive.NewObjectID(),
-				UserID:      userID,
-				ImageURL:    req.ImageURL,
-				Status:      models.StatusPending,
-				CreatedAt:   time.Now(),
-				UpdatedAt:   time.Now(),
-			}
-
-			// Save to MongoDB
-			_, err := taskCollection.InsertOne(context.Background(), task)
-			if err != nil {
-				slog.Error("Upload: Failed to save task", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
-				return
-			}
-
-			// Increment Task Created Metric
-			// We track this to monitor the rate of new tasks entering the system.
-			// This is a key business metric.
-			metrics.TasksCreatedTotal.Inc()
-
-			// Publish event to Kafka
-			err = kafkaProducer.PublishTask(context.Background(), kafka.TaskEvent{
-				TaskID:      task.ID.Hex(),
-				UserID:      task.UserID,
-				ImageURL:    task.ImageURL,
-			})
-			if err != nil {
-				// Note: In production, we might want to rollback the DB insert or retry
-				slog.Error("Upload: Failed to publish to Kafka", "error", err)
-				// Track publish errors to alert on Kafka connectivity issues
-				metrics.KafkaPublishErrorsTotal.Inc()
-			} else {
-				slog.Info("Task published to Kafka", "task_id", task.ID.Hex())
-				// Track successful publishes to measure throughput
-				metrics.KafkaMessagesPublishedTotal.Inc()
-			}
-
-			c.JSON(http.StatusCreated, task)
-		})
+		read := middleware.RequireScope(middleware.ScopeTasksRead)
+		write := middleware.RequireScope(middleware.ScopeTasksWrite)
+		limit := rateLimiter.Middleware()
+
+		// POST /api/upload - Create a new task from an image URL
+		// Replays come before the rate limit, so retries do not count against it
+		authRoutes.POST("/upload", write, idempotent.Middleware(), limit, taskHandler.Upload)
+
+		// POST /api/upload/file - Create a new task from a multipart file upload
+		authRoutes.POST("/upload/file", write, limit, taskHandler.UploadFile)
 
 		// GET /api/tasks - List user's tasks
-		authRoutes.GET("/tasks", func(c *gin.Context) {
-			userID := c.GetString("userID")
+		authRoutes.GET("/tasks", read, taskHandler.List)
+
+		// GET /api/tasks/stream - Server-Sent Events with the user's task status changes
+		authRoutes.GET("/tasks/stream", read, streamHandler.Stream)
 
-			// Increment Task Retrieval Metric
-			metrics.TasksRetrievedTotal.Inc()
+		// GET /api/tasks/:id - Fetch a single task
+		authRoutes.GET("/tasks/:id", read, taskHandler.Get)
 
-			// Find tasks for this user
-			cursor, err := taskCollection.Find(context.Background(), bson.M{"user_id": userID})
-			if err != nil {
-				slog.Error("ListTasks: DB Query failed", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
-				return
-			}
-			defer cursor.Close(context.Background())
+		// POST /api/tasks/:id/cancel - Cancel a pending or processing task
+		authRoutes.POST("/tasks/:id/cancel", write, taskHandler.Cancel)
+
+		// DELETE /api/tasks/:id - Delete a finished task and its images
+		authRoutes.DELETE("/tasks/:id", write, taskHandler.Delete)
+
+		// Webhooks - Notify the user's own endpoints when tasks complete or fail
+		webhooksRead := middleware.RequireScope(middleware.ScopeWebhooksRead)
+		webhooksWrite := middleware.RequireScope(middleware.ScopeWebhooksWrite)
+		authRoutes.POST("/webhooks", webhooksWrite, webhookHandler.Create)
+		authRoutes.GET("/webhooks", webhooksRead, webhookHandler.List)
+		authRoutes.DELETE("/webhooks/:id", webhooksWrite, webhookHandler.Delete)
+		authRoutes.GET("/webhooks/:id/deliveries", webhooksRead, webhookHandler.Deliveries)
+	}
+
+	// Admin Routes (Require the admin:tasks scope)
+	adminRoutes := r.Group("/api/admin").Use(authMiddleware.Middleware(), middleware.RequireScope(middleware.ScopeAdminTasks))
+	{
+		// GET /api/admin/tasks - List all users' tasks
+		adminRoutes.GET("/tasks", taskHandler.ListAll)
 
-			var tasks []models.Task
-			if err = cursor.All(context.Background(), &tasks); err != nil {
-				slog.Error("ListTasks: Decode failed", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode tasks"})
-				return
-			}
+		// POST /api/admin/tasks/:id/requeue - Process a FAILED task again
+		adminRoutes.POST("/tasks/:id/requeue", taskHandler.Requeue)
+	}
+
+	// 6. Start Server
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+	go func() {
+		slog.Info("API Service listening", "address", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Failed to start server", "error", err)
+			stop()
+		}
+	}()
+
+	// 7. Graceful Shutdown
+	// Stop accepting connections and let in-flight requests (e.g., uploads) finish,
+	// then stop the relay and webhooks and close Kafka and MongoDB, all within SHUTDOWN_TIMEOUT
+	<-ctx.Done()
+	slog.Info("Shutting down API Service", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to drain HTTP server", "error", err)
+	}
+
+	stopRelay()
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Outbox relay did not stop in time")
+	}
 
-			c.JSON(http.StatusOK, tasks)
-		})
+	stopWebhooks()
+	select {
+	case <-webhooksDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Webhook dispatcher did not stop in time")
 	}
 
-	// 5. Start Server
-	slog.Info("API Service listening", "address", ":"+port)
-	if err := r.Run(":" + port); err != nil {
-		slog.Error("Failed to start server", "error", err)
+	taskEvents.Close()
+	kafkaProducer.Close()
+	if err := dbHandler.Close(shutdownCtx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
 	}
+	slog.Info("API Service stopped")
 }
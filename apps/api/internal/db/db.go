@@ -2,15 +2,20 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/sanjain/pixelflow/pkg/outbox"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type Handler struct {
-	DB *mongo.Database
+	Client *mongo.Client
+	DB     *mongo.Database
 }
 
 func Init(url, dbName string) *Handler {
@@ -27,6 +32,94 @@ func Init(url, dbName string) *Handler {
 		log.Fatalln(err)
 	}
 
+	// Tasks and their outbox messages are written in transactions, which need a replica set
+	if err := requireReplicaSet(ctx, client); err != nil {
+		log.Fatalln(err)
+	}
+
+	db := client.Database(dbName)
+	if err := ensureIndexes(ctx, db); err != nil {
+		log.Fatalln(err)
+	}
+
 	log.Println("Connected to MongoDB")
-	return &Handler{DB: client.Database(dbName)}
+	return &Handler{Client: client, DB: db}
+}
+
+// Close disconnects the MongoDB client, waiting for in-use connections until ctx expires.
+func (h *Handler) Close(ctx context.Context) error {
+	return h.Client.Disconnect(ctx)
+}
+
+// requireReplicaSet fails unless the server is a replica set member. A standalone
+// mongod accepts connections but rejects every transaction, so without this check
+// each upload would fail with a 500.
+func requireReplicaSet(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("failed to run hello: %w", err)
+	}
+	if hello.SetName == "" {
+		return errors.New("MongoDB is not running as a replica set, but the API needs transactions: " +
+			"start mongod with --replSet and run rs.initiate() (a single-node set is enough), " +
+			"or use the mongo service from docker-compose")
+	}
+	return nil
+}
+
+// ensureIndexes creates the indexes the API relies on. CreateMany is a no-op
+// for indexes that already exist with the same definition.
+func ensureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("tasks").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Task listing: a user's tasks in (created_at, _id) order, in either direction
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		// Task listing filtered by status
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		// Admin listing across all users, optionally by status
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("webhooks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("webhook_deliveries").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// One delivery per webhook and event, however often the event is consumed
+		{
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// Dispatcher polling: due pending deliveries
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		// Delivery log: a webhook's deliveries, newest first
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		// Deliveries are kept for 30 days
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("created_at_ttl").SetExpireAfterSeconds(30 * 24 * 60 * 60),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := outbox.New(db, outbox.DefaultCollection).EnsureIndexes(ctx); err != nil {
+		return err
+	}
+
+	// Idempotency keys are unique by _id (user and key); each record carries its own expiry
+	_, err = db.Collection("idempotency_keys").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+	})
+	return err
 }
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errNotFailed aborts a requeue transaction when the task is not FAILED
+var errNotFailed = errors.New("task is not failed")
+
+// ListAll handles GET /api/admin/tasks - List all users' tasks.
+// Accepts the same query parameters as List, plus user_id to narrow down to one user.
+func (h *TaskHandler) ListAll(c *gin.Context) {
+	h.listTasks(c, "AdminListTasks", c.Query("user_id"))
+}
+
+// Requeue handles POST /api/admin/tasks/:id/requeue - Put a FAILED task back in the queue.
+// The task is reset to PENDING and a new event is written to the outbox in the same
+// transaction, so the worker processes it again with a fresh retry budget.
+func (h *TaskHandler) Requeue(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var task models.Task
+	err = h.tasks.FindOne(ctx, bson.M{"_id": id}).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if err != nil {
+		slog.Error("RequeueTask: DB query failed", "task_id", id.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+		return
+	}
+	if task.Status != models.StatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only FAILED tasks can be requeued; task is " + string(task.Status)})
+		return
+	}
+
+	msg, err := taskMessage(ctx, task)
+	if err != nil {
+		slog.Error("RequeueTask: Failed to encode task event", "task_id", id.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue task"})
+		return
+	}
+
+	// Reset the task + write its outbox message atomically.
+	// The status condition makes concurrent requeues of the same task publish only once.
+	session, err := h.db.Client().StartSession()
+	if err != nil {
+		slog.Error("RequeueTask: Failed to start session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue task"})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	now := time.Now()
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		res, err := h.tasks.UpdateOne(sc,
+			bson.M{"_id": id, "status": models.StatusFailed},
+			bson.M{
+				"$set":   bson.M{"status": models.StatusPending, "updated_at": now},
+				"$unset": bson.M{"error": "", "processed_key": "", "processed_url": ""},
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 0 {
+			return nil, errNotFailed
+		}
+		return nil, h.outbox.Insert(sc, msg)
+	})
+	if errors.Is(err, errNotFailed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Task is no longer FAILED"})
+		return
+	}
+	if err != nil {
+		slog.Error("RequeueTask: Failed to requeue task", "task_id", id.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue task"})
+		return
+	}
+
+	// Publish right away instead of waiting for the next poll
+	h.relay.Notify()
+	slog.Info("Task requeued", "task_id", id.Hex(), "user_id", task.UserID, "by", c.GetString("userID"))
+
+	task.Status = models.StatusPending
+	task.UpdatedAt = now
+	task.Error = ""
+	task.ProcessedKey = ""
+	task.ProcessedURL = ""
+	h.signURLs(ctx, &task)
+	c.JSON(http.StatusOK, task)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Page size limits for GET /api/tasks
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// taskQuery is the parsed form of the GET /api/tasks query string.
+type taskQuery struct {
+	limit    int
+	statuses []models.TaskStatus
+	from, to time.Time // created_at range; zero means unbounded
+	asc      bool      // oldest first instead of newest first
+	after    *taskCursor
+}
+
+// taskCursor points at the last task of a page. Pages are ordered by
+// (created_at, _id), so the _id breaks ties between tasks created in the same millisecond.
+type taskCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+// encode returns the opaque cursor string handed to clients.
+func (c taskCursor) encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMilli(), 10) + "_" + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeTaskCursor parses a cursor produced by taskCursor.encode.
+func decodeTaskCursor(s string) (*taskCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	millis, hex, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &taskCursor{CreatedAt: time.UnixMilli(ms), ID: id}, nil
+}
+
+// parseTaskQuery reads limit, cursor, status (comma-separated), from/to (RFC 3339)
+// and order (asc|desc) from the query string.
+func parseTaskQuery(get func(string) string) (taskQuery, error) {
+	q := taskQuery{limit: DefaultPageSize}
+
+	if v := get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		q.limit = min(n, MaxPageSize)
+	}
+
+	if v := get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			status := models.TaskStatus(strings.ToUpper(strings.TrimSpace(s)))
+			if !status.Valid() {
+				return q, fmt.Errorf("unknown status %q", s)
+			}
+			q.statuses = append(q.statuses, status)
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.from}, {"to", &q.to}} {
+		if v := get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 timestamp", p.name)
+			}
+			*p.dst = t
+		}
+	}
+
+	switch get("order") {
+	case "", "desc":
+	case "asc":
+		q.asc = true
+	default:
+		return q, errors.New("order must be 'asc' or 'desc'")
+	}
+
+	if v := get("cursor"); v != "" {
+		cursor, err := decodeTaskCursor(v)
+		if err != nil {
+			return q, err
+		}
+		q.after = cursor
+	}
+
+	return q, nil
+}
+
+// filter builds the Mongo filter for the user's tasks matching q.
+// An empty userID matches all users' tasks (admin listing).
+func (q taskQuery) filter(userID string) bson.M {
+	filter := bson.M{}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+
+	if len(q.statuses) > 0 {
+		filter["status"] = bson.M{"$in": q.statuses}
+	}
+
+	createdAt := bson.M{}
+	if !q.from.IsZero() {
+		createdAt["$gte"] = q.from
+	}
+	if !q.to.IsZero() {
+		createdAt["$lt"] = q.to
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	// Keyset pagination: continue strictly after the cursor in sort order
+	if q.after != nil {
+		op := "$lt"
+		if q.asc {
+			op = "$gt"
+		}
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{op: q.after.CreatedAt}},
+			bson.M{"created_at": q.after.CreatedAt, "_id": bson.M{op: q.after.ID}},
+		}
+	}
+
+	return filter
+}
+
+// sort returns the sort order matching the cursor fields.
+func (q taskQuery) sort() bson.D {
+	dir := -1
+	if q.asc {
+		dir = 1
+	}
+	return bson.D{{Key: "created_at", Value: dir}, {Key: "_id", Value: dir}}
+}
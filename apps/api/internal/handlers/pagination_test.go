@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTaskCursorRoundTrip(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("652f1c0e8b3e4a0001a1b2c3")
+	for _, createdAt := range []time.Time{
+		time.Date(2024, 10, 1, 12, 0, 0, 123_000_000, time.UTC),
+		time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2099, 12, 31, 23, 59, 59, 999_000_000, time.UTC),
+	} {
+		in := taskCursor{CreatedAt: createdAt, ID: id}
+		out, err := decodeTaskCursor(in.encode())
+		if err != nil {
+			t.Fatalf("decode(encode(%v)): %v", createdAt, err)
+		}
+		if !out.CreatedAt.Equal(in.CreatedAt) || out.ID != in.ID {
+			t.Errorf("round trip of %v = %+v", in, out)
+		}
+	}
+}
+
+func TestDecodeTaskCursorRejectsMalformed(t *testing.T) {
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, cursor := range []string{
+		"not base64!",
+		b64("1727784000000"),                             // No separator
+		b64("_652f1c0e8b3e4a0001a1b2c3"),                 // No time
+		b64("soon_652f1c0e8b3e4a0001a1b2c3"),             // Time not a number
+		b64("1727784000000_"),                            // No ID
+		b64("1727784000000_652f1c0e8b3e4a0001a1b2"),      // ID too short
+		b64("1727784000000_zzzf1c0e8b3e4a0001a1b2c3"),    // ID not hex
+		base64.StdEncoding.EncodeToString([]byte("1_?")), // Wrong alphabet/padding
+	} {
+		if c, err := decodeTaskCursor(cursor); err == nil {
+			t.Errorf("decodeTaskCursor(%q) = %+v, want an error", cursor, c)
+		}
+	}
+}
+
+// query returns a getter over the given query parameters.
+func query(params map[string]string) func(string) string {
+	return func(name string) string { return params[name] }
+}
+
+func TestParseTaskQuery(t *testing.T) {
+	from := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 10, 1, 22, 0, 0, 0, time.UTC) // Given with a +02:00 offset
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    taskQuery
+		wantErr bool
+	}{
+		{"defaults", nil, taskQuery{limit: DefaultPageSize}, false},
+		{"limit", map[string]string{"limit": "5"}, taskQuery{limit: 5}, false},
+		{"limit capped", map[string]string{"limit": "1000"}, taskQuery{limit: MaxPageSize}, false},
+		{"limit zero", map[string]string{"limit": "0"}, taskQuery{}, true},
+		{"limit not a number", map[string]string{"limit": "ten"}, taskQuery{}, true},
+		{"statuses", map[string]string{"status": "failed, completed"},
+			taskQuery{limit: DefaultPageSize, statuses: []models.TaskStatus{models.StatusFailed, models.StatusCompleted}}, false},
+		{"unknown status", map[string]string{"status": "FAILED,DONE"}, taskQuery{}, true},
+		{"range", map[string]string{"from": "2024-10-01T00:00:00Z", "to": "2024-10-02T00:00:00+02:00"},
+			taskQuery{limit: DefaultPageSize, from: from, to: to}, false},
+		{"bad from", map[string]string{"from": "2024-10-01"}, taskQuery{}, true},
+		{"bad to", map[string]string{"to": "yesterday"}, taskQuery{}, true},
+		{"ascending", map[string]string{"order": "asc"}, taskQuery{limit: DefaultPageSize, asc: true}, false},
+		{"descending", map[string]string{"order": "desc"}, taskQuery{limit: DefaultPageSize}, false},
+		{"bad order", map[string]string{"order": "newest"}, taskQuery{}, true},
+		{"bad cursor", map[string]string{"cursor": "abc"}, taskQuery{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTaskQuery(query(tt.params))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		// Compare instants, not the zones they were given in
+		got.from, got.to = got.from.UTC(), got.to.UTC()
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseTaskQuery = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTaskQueryFilter(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("652f1c0e8b3e4a0001a1b2c3")
+	at := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	from := time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC)
+	cursor := &taskCursor{CreatedAt: at, ID: id}
+
+	tests := []struct {
+		name   string
+		q      taskQuery
+		userID string
+		want   bson.M
+		sort   bson.D
+	}{
+		{"user's tasks", taskQuery{}, "42", bson.M{"user_id": "42"},
+			bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{"all users (admin)", taskQuery{}, "", bson.M{},
+			bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{"statuses and range", taskQuery{statuses: []models.TaskStatus{models.StatusFailed}, from: from, to: to}, "42",
+			bson.M{
+				"user_id":    "42",
+				"status":     bson.M{"$in": []models.TaskStatus{models.StatusFailed}},
+				"created_at": bson.M{"$gte": from, "$lt": to},
+			},
+			bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{"only from", taskQuery{from: from}, "42",
+			bson.M{"user_id": "42", "created_at": bson.M{"$gte": from}},
+			bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{"after cursor, newest first", taskQuery{after: cursor}, "42",
+			bson.M{"user_id": "42", "$or": bson.A{
+				bson.M{"created_at": bson.M{"$lt": at}},
+				bson.M{"created_at": at, "_id": bson.M{"$lt": id}},
+			}},
+			bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{"after cursor, oldest first", taskQuery{after: cursor, asc: true}, "42",
+			bson.M{"user_id": "42", "$or": bson.A{
+				bson.M{"created_at": bson.M{"$gt": at}},
+				bson.M{"created_at": at, "_id": bson.M{"$gt": id}},
+			}},
+			bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+	}
+	for _, tt := range tests {
+		if got := tt.q.filter(tt.userID); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: filter = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.q.sort(); !reflect.DeepEqual(got, tt.sort) {
+			t.Errorf("%s: sort = %v, want %v", tt.name, got, tt.sort)
+		}
+	}
+}
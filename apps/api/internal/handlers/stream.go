@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/stream"
+)
+
+// streamHeartbeat is how often an SSE comment is sent to keep idle connections
+// (and the proxies in between) from timing out
+const streamHeartbeat = 15 * time.Second
+
+// StreamHandler serves the Server-Sent Events endpoint.
+type StreamHandler struct {
+	hub   *stream.Hub
+	tasks *TaskHandler
+}
+
+// NewStreamHandler creates a new StreamHandler.
+// tasks: Used to sign object URLs in streamed tasks
+func NewStreamHandler(hub *stream.Hub, tasks *TaskHandler) *StreamHandler {
+	return &StreamHandler{hub: hub, tasks: tasks}
+}
+
+// Stream handles GET /api/tasks/stream - Push the user's task changes as Server-Sent Events.
+// Every created task and every status change is sent as a "task" event whose data
+// is the task JSON. The stream ends when the client disconnects, falls too far
+// behind, or the server shuts down; clients should reconnect and reload their tasks.
+func (h *StreamHandler) Stream(c *gin.Context) {
+	userID := c.GetString("userID")
+	updates, unsubscribe := h.hub.Subscribe(userID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx response buffering
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case task, ok := <-updates:
+			if !ok {
+				return false
+			}
+			h.tasks.signURLs(c.Request.Context(), &task)
+			c.SSEvent("task", task)
+		case <-heartbeat.C:
+			// Comment lines are ignored by EventSource clients
+			io.WriteString(w, ": heartbeat\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/idempotency"
+	"github.com/sanjain/pixelflow/apps/api/internal/kafka"
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/sanjain/pixelflow/pkg/outbox"
+	"github.com/sanjain/pixelflow/pkg/safehttp"
+	"github.com/sanjain/pixelflow/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SignedURLExpiry is the lifetime of object URLs handed out to clients
+const SignedURLExpiry = time.Hour
+
+// allowedContentTypes maps accepted upload MIME types to file extensions
+var allowedContentTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// TaskHandler serves the task endpoints under /api.
+type TaskHandler struct {
+	db             *mongo.Database
+	tasks          *mongo.Collection
+	outbox         *outbox.Outbox
+	relay          *outbox.Relay
+	blob           storage.Blob
+	maxUploadBytes int64
+}
+
+// NewTaskHandler creates a new TaskHandler.
+// relay: Outbox relay that publishes task events to Kafka
+// maxUploadBytes: Largest file accepted by UploadFile
+func NewTaskHandler(db *mongo.Database, relay *outbox.Relay, blob storage.Blob, maxUploadBytes int64) *TaskHandler {
+	return &TaskHandler{
+		db:             db,
+		tasks:          db.Collection("tasks"),
+		outbox:         outbox.New(db, outbox.DefaultCollection),
+		relay:          relay,
+		blob:           blob,
+		maxUploadBytes: maxUploadBytes,
+	}
+}
+
+// Upload handles POST /api/upload - Create a new task from an image URL
+func (h *TaskHandler) Upload(c *gin.Context) {
+	// Get UserID from context (set by middleware)
+	userID := c.GetString("userID")
+
+	// Parse request body
+	var req struct {
+		ImageURL   string             `json:"image_url" binding:"required"`
+		Operations []models.Operation `json:"operations"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Upload: Invalid request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only the scheme is checked here; the worker refuses internal addresses when it connects
+	if err := safehttp.CheckURL(req.ImageURL, true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_url must be an absolute http or https URL"})
+		return
+	}
+
+	ops, err := normalizeOperations(req.Operations)
+	if err != nil {
+		slog.Warn("Upload: Invalid operations", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create Task object
+	task := models.Task{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		ImageURL:   req.ImageURL,
+		Operations: ops,
+		Status:     models.StatusPending,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	h.createTask(c, task)
+}
+
+// UploadFile handles POST /api/upload/file - Create a new task from a multipart file upload.
+// Form fields: "file" (required, JPEG/PNG/GIF) and "operations" (optional JSON array).
+func (h *TaskHandler) UploadFile(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	// Cap the whole request body (file plus a little room for the other form fields)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUploadBytes+(1<<20))
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds maximum size of %d bytes", h.maxUploadBytes)})
+			return
+		}
+		slog.Warn("UploadFile: Missing file", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Form field 'file' is required"})
+		return
+	}
+	if fileHeader.Size > h.maxUploadBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds maximum size of %d bytes", h.maxUploadBytes)})
+		return
+	}
+
+	var reqOps []models.Operation
+	if raw := c.PostForm("operations"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &reqOps); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "operations must be a JSON array"})
+			return
+		}
+	}
+	ops, err := normalizeOperations(reqOps)
+	if err != nil {
+		slog.Warn("UploadFile: Invalid operations", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		slog.Error("UploadFile: Failed to open file", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	// Sniff the real content type instead of trusting the client's header
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	ext, ok := allowedContentTypes[contentType]
+	if !ok {
+		slog.Warn("UploadFile: Unsupported content type", "content_type", contentType)
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported file type " + contentType + " (allowed: JPEG, PNG, GIF)"})
+		return
+	}
+
+	// Store the original
+	taskID := primitive.NewObjectID()
+	key := fmt.Sprintf("originals/%s.%s", taskID.Hex(), ext)
+	body := io.MultiReader(bytes.NewReader(head), file)
+	if err := h.blob.Put(c.Request.Context(), key, body, fileHeader.Size, contentType); err != nil {
+		slog.Error("UploadFile: Failed to store original", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+
+	// Until the task is saved nothing refers to the original, so remove it if saving fails.
+	// This includes an Idempotency-Key taken over by a retry, which stores its own copy.
+	created := false
+	defer func() {
+		if !created {
+			h.deleteOriginal(c.Request.Context(), taskID, key)
+		}
+	}()
+
+	imageURL, err := h.blob.SignedURL(c.Request.Context(), key, SignedURLExpiry)
+	if err != nil {
+		slog.Error("UploadFile: Failed to sign URL", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return
+	}
+
+	task := models.Task{
+		ID:          taskID,
+		UserID:      userID,
+		ImageURL:    imageURL,
+		OriginalKey: key,
+		Operations:  ops,
+		Status:      models.StatusPending,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	created = h.createTask(c, task)
+}
+
+// deleteOriginal removes an uploaded original whose task was not created.
+// It runs even if the client has gone away; failures only leave an unused object behind.
+func (h *TaskHandler) deleteOriginal(ctx context.Context, taskID primitive.ObjectID, key string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	// A commit can fail to report success; keep the original if the task exists after all
+	n, err := h.tasks.CountDocuments(ctx, bson.M{"_id": taskID})
+	if err != nil || n > 0 {
+		slog.Warn("UploadFile: Keeping original of unconfirmed task", "task_id", taskID.Hex(), "key", key, "error", err)
+		return
+	}
+	if err := h.blob.Delete(ctx, key); err != nil {
+		slog.Warn("UploadFile: Failed to delete orphaned original", "key", key, "error", err)
+	}
+}
+
+// List handles GET /api/tasks - List user's tasks, newest first, one page at a time.
+// Query parameters: limit, cursor, status, from, to, order (see parseTaskQuery).
+// The response's next_cursor is empty on the last page.
+func (h *TaskHandler) List(c *gin.Context) {
+	// Increment Task Retrieval Metric
+	metrics.TasksRetrievedTotal.Inc()
+
+	h.listTasks(c, "ListTasks", c.GetString("userID"))
+}
+
+// listTasks writes one page of the tasks matching the query string.
+// An empty userID lists all users' tasks; op prefixes the log messages.
+func (h *TaskHandler) listTasks(c *gin.Context, op, userID string) {
+	ctx := c.Request.Context()
+
+	q, err := parseTaskQuery(c.Query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Fetch one extra task to find out whether another page exists
+	opts := options.Find().SetSort(q.sort()).SetLimit(int64(q.limit + 1))
+	cursor, err := h.tasks.Find(ctx, q.filter(userID), opts)
+	if err != nil {
+		slog.Error(op+": DB Query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tasks"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	tasks := []models.Task{}
+	if err = cursor.All(ctx, &tasks); err != nil {
+		slog.Error(op+": Decode failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode tasks"})
+		return
+	}
+
+	nextCursor := ""
+	if len(tasks) > q.limit {
+		tasks = tasks[:q.limit]
+		last := tasks[len(tasks)-1]
+		nextCursor = taskCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+	}
+
+	for i := range tasks {
+		h.signURLs(ctx, &tasks[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tasks":       tasks,
+		"next_cursor": nextCursor,
+	})
+}
+
+// Get handles GET /api/tasks/:id - Fetch a single task owned by the user
+func (h *TaskHandler) Get(c *gin.Context) {
+	task, ok := h.loadOwnedTask(c)
+	if !ok {
+		return
+	}
+
+	h.signURLs(c.Request.Context(), &task)
+	c.JSON(http.StatusOK, task)
+}
+
+// Cancel handles POST /api/tasks/:id/cancel - Cancel a task that has not finished yet.
+// The worker checks the status before and after processing, so a cancelled task is
+// never started, and a task cancelled mid-processing never becomes COMPLETED.
+func (h *TaskHandler) Cancel(c *gin.Context) {
+	task, ok := h.loadOwnedTask(c)
+	if !ok {
+		return
+	}
+
+	// Conditional update: only PENDING/PROCESSING tasks can be cancelled,
+	// even if the worker finishes the task between the load and this update
+	ctx := c.Request.Context()
+	filter := bson.M{
+		"_id":     task.ID,
+		"user_id": task.UserID,
+		"status":  bson.M{"$in": []models.TaskStatus{models.StatusPending, models.StatusProcessing}},
+	}
+	update := bson.M{"$set": bson.M{"status": models.StatusCancelled, "updated_at": time.Now()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated models.Task
+	err := h.tasks.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Task already finished"})
+		return
+	}
+	if err != nil {
+		slog.Error("CancelTask: DB update failed", "task_id", task.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel task"})
+		return
+	}
+
+	slog.Info("Task cancelled", "task_id", task.ID.Hex())
+	h.signURLs(ctx, &updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete handles DELETE /api/tasks/:id - Remove a finished task and its stored images.
+// Unfinished tasks must be cancelled first so the worker never sees a missing task.
+func (h *TaskHandler) Delete(c *gin.Context) {
+	task, ok := h.loadOwnedTask(c)
+	if !ok {
+		return
+	}
+	if !task.Status.IsTerminal() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Task is still " + string(task.Status) + "; cancel it first"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.tasks.DeleteOne(ctx, bson.M{"_id": task.ID, "user_id": task.UserID}); err != nil {
+		slog.Error("DeleteTask: DB delete failed", "task_id", task.ID.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete task"})
+		return
+	}
+
+	// Objects are removed after the task, so a failure here only leaves orphaned files
+	for _, key := range []string{task.OriginalKey, task.ProcessedKey} {
+		if key == "" {
+			continue
+		}
+		if err := h.blob.Delete(ctx, key); err != nil {
+			slog.Warn("DeleteTask: Failed to delete object", "task_id", task.ID.Hex(), "key", key, "error", err)
+		}
+	}
+
+	slog.Info("Task deleted", "task_id", task.ID.Hex())
+	c.Status(http.StatusNoContent)
+}
+
+// loadOwnedTask loads the task named by the :id parameter and writes an error
+// response if it does not exist or belongs to another user. Other users' tasks
+// are reported as not found so task IDs cannot be probed.
+func (h *TaskHandler) loadOwnedTask(c *gin.Context) (models.Task, bool) {
+	var task models.Task
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task id"})
+		return task, false
+	}
+
+	filter := bson.M{"_id": id, "user_id": c.GetString("userID")}
+	err = h.tasks.FindOne(c.Request.Context(), filter).Decode(&task)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return task, false
+	}
+	if err != nil {
+		slog.Error("GetTask: DB query failed", "task_id", id.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch task"})
+		return task, false
+	}
+	return task, true
+}
+
+// createTask saves the task together with its outbox event and writes the 201 response.
+// Both documents are inserted in one transaction, so a task can never exist without
+// the event that gets it processed; the outbox relay publishes the event to Kafka.
+// It reports whether the task was saved; otherwise an error response has been written.
+func (h *TaskHandler) createTask(c *gin.Context, task models.Task) bool {
+	ctx := c.Request.Context()
+
+	msg, err := taskMessage(ctx, task)
+	if err != nil {
+		slog.Error("Upload: Failed to encode task event", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return false
+	}
+
+	// A retry-safe request stores its response with the task, to replay on repeats
+	var reservation *idempotency.Reservation
+	var body []byte
+	if v, ok := c.Get(idempotency.ContextKey); ok {
+		reservation = v.(*idempotency.Reservation)
+		if body, err = json.Marshal(task); err != nil {
+			slog.Error("Upload: Failed to encode task", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+			return false
+		}
+	}
+
+	// Save task + outbox message (+ idempotency record) atomically
+	session, err := h.db.Client().StartSession()
+	if err != nil {
+		slog.Error("Upload: Failed to start session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return false
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := h.tasks.InsertOne(sc, task); err != nil {
+			return nil, err
+		}
+		if err := h.outbox.Insert(sc, msg); err != nil {
+			return nil, err
+		}
+		if reservation != nil {
+			return nil, reservation.Complete(sc, http.StatusCreated, body)
+		}
+		return nil, nil
+	})
+	if errors.Is(err, idempotency.ErrLeaseLost) {
+		slog.Warn("Upload: Idempotency key taken over by a retry", "task_id", task.ID.Hex())
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		return false
+	}
+	if err != nil {
+		slog.Error("Upload: Failed to save task", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		return false
+	}
+
+	// Increment Task Created Metric
+	// We track this to monitor the rate of new tasks entering the system.
+	// This is a key business metric.
+	metrics.TasksCreatedTotal.Inc()
+
+	// Publish right away instead of waiting for the next poll
+	h.relay.Notify()
+	slog.Info("Task created", "task_id", task.ID.Hex())
+
+	if reservation != nil {
+		c.Data(http.StatusCreated, "application/json; charset=utf-8", body)
+		return true
+	}
+	c.JSON(http.StatusCreated, task)
+	return true
+}
+
+// taskMessage builds the outbox message that gets the task processed.
+func taskMessage(ctx context.Context, task models.Task) (outbox.Message, error) {
+	ops := make([]events.Operation, len(task.Operations))
+	for i, op := range task.Operations {
+		ops[i] = events.Operation(op)
+	}
+	payload, err := events.EncodeTaskEvent(events.TaskEvent{
+		TaskID:      task.ID.Hex(),
+		UserID:      task.UserID,
+		ImageURL:    task.ImageURL,
+		OriginalKey: task.OriginalKey,
+		Operations:  ops,
+	})
+	if err != nil {
+		return outbox.Message{}, err
+	}
+	return outbox.NewMessage(ctx, kafka.TopicImageTasks, task.ID.Hex(), payload), nil
+}
+
+// signURLs replaces stored object URLs with freshly signed ones,
+// so clients always receive a valid link.
+func (h *TaskHandler) signURLs(ctx context.Context, task *models.Task) {
+	if task.OriginalKey != "" {
+		if url, err := h.blob.SignedURL(ctx, task.OriginalKey, SignedURLExpiry); err == nil {
+			task.ImageURL = url
+		} else {
+			slog.Warn("Failed to sign original URL", "task_id", task.ID.Hex(), "error", err)
+		}
+	}
+	if task.ProcessedKey != "" {
+		if url, err := h.blob.SignedURL(ctx, task.ProcessedKey, SignedURLExpiry); err == nil {
+			task.ProcessedURL = url
+		} else {
+			slog.Warn("Failed to sign processed URL", "task_id", task.ID.Hex(), "error", err)
+		}
+	}
+}
+
+// normalizeOperations applies the default pipeline to empty lists and validates the result.
+func normalizeOperations(ops []models.Operation) ([]models.Operation, error) {
+	if len(ops) == 0 {
+		ops = models.DefaultOperations
+	}
+	if err := models.ValidateOperations(ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/api/internal/kafka"
+	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden event files")
+
+// taskEventGolden is the API's encoded TaskEvent; the worker's tests decode it.
+const taskEventGolden = "../../../../pkg/events/testdata/task_event.json"
+
+// TestTaskMessageMatchesGolden pins the bytes the API publishes to "image-tasks".
+// Run with -update after an intentional contract change, then run the worker's tests.
+func TestTaskMessageMatchesGolden(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("652f1c0e8b3e4a0001a1b2c3")
+	task := models.Task{
+		ID:          id,
+		UserID:      "42",
+		ImageURL:    "https://example.com/cat.jpg",
+		OriginalKey: "originals/652f1c0e8b3e4a0001a1b2c3.jpg",
+		Operations: []models.Operation{
+			{Op: models.OpResize, Width: 800},
+			{Op: models.OpCrop, X: 10, Y: 20, Width: 100, Height: 50},
+			{Op: models.OpFlip, Direction: "horizontal"},
+		},
+		Status:    models.StatusPending,
+		CreatedAt: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	msg, err := taskMessage(context.Background(), task)
+	if err != nil {
+		t.Fatalf("taskMessage: %v", err)
+	}
+	if msg.Topic != kafka.TopicImageTasks || msg.Key != task.ID.Hex() {
+		t.Errorf("message topic/key = %s/%s, want %s/%s", msg.Topic, msg.Key, kafka.TopicImageTasks, task.ID.Hex())
+	}
+
+	if *update {
+		if err := os.WriteFile(taskEventGolden, append(msg.Payload, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(taskEventGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Payload, bytes.TrimSpace(want)) {
+		t.Errorf("payload = %s\nwant (%s) = %s", msg.Payload, taskEventGolden, want)
+	}
+}
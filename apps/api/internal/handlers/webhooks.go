@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxWebhooksPerUser limits how many webhooks one user can register
+const MaxWebhooksPerUser = 10
+
+// WebhookHandler serves the webhook endpoints under /api.
+type WebhookHandler struct {
+	webhooks     *mongo.Collection
+	deliveries   *mongo.Collection
+	allowPrivate bool
+}
+
+// NewWebhookHandler creates a new WebhookHandler.
+// allowPrivate: Accept URLs with loopback and private IP hosts (local development only)
+func NewWebhookHandler(db *mongo.Database, allowPrivate bool) *WebhookHandler {
+	return &WebhookHandler{
+		webhooks:     db.Collection(webhooks.WebhooksCollection),
+		deliveries:   db.Collection(webhooks.DeliveriesCollection),
+		allowPrivate: allowPrivate,
+	}
+}
+
+// Create handles POST /api/webhooks - Register a webhook URL.
+// The response includes the signing secret; it is not shown again.
+func (h *WebhookHandler) Create(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	var req struct {
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events"` // Defaults to all events
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhooks.ValidateURL(req.URL, h.allowPrivate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Events) == 0 {
+		req.Events = webhooks.AllEvents
+	}
+	if err := webhooks.ValidateEvents(req.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := h.webhooks.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		slog.Error("CreateWebhook: DB count failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+	if count >= MaxWebhooksPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook limit reached"})
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		slog.Error("CreateWebhook: Failed to generate secret", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	hook := webhooks.Webhook{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		CreatedAt: time.Now(),
+	}
+	if _, err := h.webhooks.InsertOne(ctx, hook); err != nil {
+		slog.Error("CreateWebhook: DB insert failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	slog.Info("Webhook created", "webhook_id", hook.ID.Hex(), "user_id", userID)
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": hook,
+		"secret":  secret,
+	})
+}
+
+// List handles GET /api/webhooks - List the user's webhooks (without secrets)
+func (h *WebhookHandler) List(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	cursor, err := h.webhooks.Find(ctx, bson.M{"user_id": c.GetString("userID")})
+	if err != nil {
+		slog.Error("ListWebhooks: DB query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+	hooks := []webhooks.Webhook{}
+	if err := cursor.All(ctx, &hooks); err != nil {
+		slog.Error("ListWebhooks: Decode failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, hooks)
+}
+
+// Delete handles DELETE /api/webhooks/:id - Remove a webhook.
+// Its pending deliveries are marked FAILED; the delivery log is kept until it expires.
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.webhooks.DeleteOne(c.Request.Context(), bson.M{"_id": id, "user_id": c.GetString("userID")})
+	if err != nil {
+		slog.Error("DeleteWebhook: DB delete failed", "webhook_id", id.Hex(), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	// The dispatcher would fail them on its next attempt anyway; this only saves it the trips
+	_, err = h.deliveries.UpdateMany(c.Request.Context(),
+		bson.M{"webhook_id": id, "status": webhooks.DeliveryPending},
+		bson.M{
+			"$set":   bson.M{"status": webhooks.DeliveryFailed, "updated_at": time.Now()},
+			"$unset": bson.M{"locked_until": ""},
+		})
+	if err != nil {
+		slog.Warn("DeleteWebhook: Failed to fail pending deliveries", "webhook_id", id.Hex(), "error", err)
+	}
+
+	slog.Info("Webhook deleted", "webhook_id", id.Hex())
+	c.Status(http.StatusNoContent)
+}
+
+// Deliveries handles GET /api/webhooks/:id/deliveries - The webhook's delivery log, newest first.
+// Query parameters: limit (default 20, max 100) and status (PENDING, SUCCEEDED or FAILED).
+func (h *WebhookHandler) Deliveries(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	limit := DefaultPageSize
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = min(n, MaxPageSize)
+	}
+
+	// Deliveries of deleted webhooks stay visible to their owner
+	filter := bson.M{"webhook_id": id, "user_id": userID}
+	if status := c.Query("status"); status != "" {
+		if status != webhooks.DeliveryPending && status != webhooks.DeliverySucceeded && status != webhooks.DeliveryFailed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be PENDING, SUCCEEDED or FAILED"})
+			return
+		}
+		filter["status"] = status
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := h.deliveries.Find(ctx, filter, opts)
+	if err != nil {
+		slog.Error("ListDeliveries: DB query failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+	deliveries := []webhooks.Delivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		slog.Error("ListDeliveries: Decode failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// webhookID parses the :id parameter, writing a 400 response if it is invalid.
+func webhookID(c *gin.Context) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return id, false
+	}
+	return id, true
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDeleteWebhookFailsPendingDeliveries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const id = "652f1c0e8b3e4a0001a1b2c3"
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tests := []struct {
+		name        string
+		deleted     int
+		wantStatus  int
+		wantUpdates int
+	}{
+		{"owned webhook", 1, http.StatusNoContent, 1},
+		{"unknown webhook", 0, http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: tt.deleted}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+			)
+			h := NewWebhookHandler(mt.DB, false)
+			router := gin.New()
+			router.DELETE("/webhooks/:id", func(c *gin.Context) {
+				c.Set("userID", "42")
+			}, h.Delete)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/webhooks/"+id, nil))
+			if w.Code != tt.wantStatus {
+				mt.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			updates := 0
+			for _, started := range mt.GetAllStartedEvents() {
+				if started.CommandName != "update" {
+					continue
+				}
+				updates++
+				u := started.Command.Lookup("updates").Array().Index(0).Value().Document()
+				if status := u.Lookup("q", "status").StringValue(); status != webhooks.DeliveryPending {
+					mt.Errorf("update filter status = %q, want %s", status, webhooks.DeliveryPending)
+				}
+				if status := u.Lookup("u", "$set", "status").StringValue(); status != webhooks.DeliveryFailed {
+					mt.Errorf("update sets status %q, want %s", status, webhooks.DeliveryFailed)
+				}
+				if multi, _ := u.Lookup("multi").BooleanOK(); !multi {
+					mt.Error("update is not applied to every pending delivery")
+				}
+			}
+			if updates != tt.wantUpdates {
+				mt.Errorf("%d delivery updates, want %d", updates, tt.wantUpdates)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package idempotency makes retried requests safe: a request carrying an
+// Idempotency-Key is recorded together with a fingerprint of its body, and a
+// repeat of it gets the original response instead of running again.
+//
+// A key is first reserved (status "processing") under a short lease. The handler
+// completes the reservation in the same transaction as its own writes, so a stored
+// response always matches what was created. If the handler fails, the reservation
+// is released and the key can be retried; if the replica dies, the lease expires
+// and the next retry takes the reservation over.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CollectionName is the MongoDB collection holding idempotency records.
+const CollectionName = "idempotency_keys"
+
+// ContextKey is the Gin context key under which the middleware stores the
+// request's *Reservation.
+const ContextKey = "idempotencyReservation"
+
+// Lease is how long a reservation is held before a retry may take it over.
+// Task creation takes well under a second; the lease only matters when a replica
+// dies mid-request.
+const Lease = time.Minute
+
+// Record statuses
+const (
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+)
+
+// Errors returned by Reserve and Complete
+var (
+	ErrMismatch   = errors.New("idempotency key was used with a different request")
+	ErrInProgress = errors.New("a request with this idempotency key is in progress")
+	ErrLeaseLost  = errors.New("idempotency key reservation was taken over")
+)
+
+// Record is a stored idempotency key and, once completed, the response to replay.
+// Records are removed by a TTL index on expires_at.
+type Record struct {
+	ID             string    `bson:"_id"` // user ID and key, see recordID
+	UserID         string    `bson:"user_id"`
+	Key            string    `bson:"key"`
+	Fingerprint    string    `bson:"fingerprint"` // SHA-256 of method, path and body
+	Status         string    `bson:"status"`
+	Lease          string    `bson:"lease,omitempty"` // Token of the request holding the reservation
+	LockedUntil    time.Time `bson:"locked_until"`
+	ResponseStatus int       `bson:"response_status,omitempty"`
+	ResponseBody   []byte    `bson:"response_body,omitempty"`
+	CreatedAt      time.Time `bson:"created_at"`
+	CompletedAt    time.Time `bson:"completed_at,omitempty"`
+	ExpiresAt      time.Time `bson:"expires_at"`
+}
+
+// Reservation is a key reserved by the current request.
+type Reservation struct {
+	store *Store
+	id    string
+	lease string
+}
+
+// Store reads and writes idempotency records.
+type Store struct {
+	records *mongo.Collection
+	ttl     time.Duration
+}
+
+// NewStore creates a Store. Records are kept for ttl after they are first used;
+// a retry after that runs as a new request.
+func NewStore(db *mongo.Database, ttl time.Duration) *Store {
+	return &Store{records: db.Collection(CollectionName), ttl: ttl}
+}
+
+// Fingerprint identifies a request by its method, path and body.
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Reserve claims key for the user's request with the given fingerprint.
+// It returns either a Reservation to complete or release, or the completed Record
+// of an earlier identical request to replay. It fails with ErrMismatch if the key
+// was used for a different request and ErrInProgress if that request is still running.
+func (s *Store) Reserve(ctx context.Context, userID, key, fingerprint string) (*Reservation, *Record, error) {
+	now := time.Now()
+	lease := newLease()
+	rec := Record{
+		ID:          recordID(userID, key),
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      StatusProcessing,
+		Lease:       lease,
+		LockedUntil: now.Add(Lease),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	// 1. First use of the key
+	_, err := s.records.InsertOne(ctx, rec)
+	if err == nil {
+		return &Reservation{store: s, id: rec.ID, lease: lease}, nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, nil, err
+	}
+
+	// 2. Seen before: replay, reject, or take over an abandoned reservation
+	var existing Record
+	if err := s.records.FindOne(ctx, bson.M{"_id": rec.ID}).Decode(&existing); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Released (or expired) in the meantime
+			return nil, nil, ErrInProgress
+		}
+		return nil, nil, err
+	}
+	if existing.Fingerprint != fingerprint {
+		return nil, nil, ErrMismatch
+	}
+	if existing.Status == StatusCompleted {
+		return nil, &existing, nil
+	}
+	if existing.LockedUntil.After(now) {
+		return nil, nil, ErrInProgress
+	}
+
+	res, err := s.records.UpdateOne(ctx,
+		bson.M{"_id": rec.ID, "status": StatusProcessing, "lease": existing.Lease},
+		bson.M{"$set": bson.M{"lease": lease, "locked_until": now.Add(Lease)}},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.ModifiedCount == 0 {
+		// Another retry took it over first
+		return nil, nil, ErrInProgress
+	}
+	return &Reservation{store: s, id: rec.ID, lease: lease}, nil, nil
+}
+
+// Complete stores the response for the reserved key. Call it inside the same
+// transaction (session context) as the writes the response describes. It fails
+// with ErrLeaseLost if the reservation expired and was taken over by a retry,
+// in which case the transaction must be aborted.
+func (r *Reservation) Complete(ctx context.Context, status int, body []byte) error {
+	res, err := r.store.records.UpdateOne(ctx,
+		bson.M{"_id": r.id, "status": StatusProcessing, "lease": r.lease},
+		bson.M{
+			"$set": bson.M{
+				"status":          StatusCompleted,
+				"response_status": status,
+				"response_body":   body,
+				"completed_at":    time.Now(),
+			},
+			"$unset": bson.M{"lease": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Release removes the reservation if it was not completed, so the key can be retried.
+func (r *Reservation) Release(ctx context.Context) error {
+	_, err := r.store.records.DeleteOne(ctx, bson.M{"_id": r.id, "status": StatusProcessing, "lease": r.lease})
+	return err
+}
+
+// recordID scopes keys per user, so users cannot see each other's responses.
+func recordID(userID, key string) string {
+	return userID + ":" + key
+}
+
+func newLease() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
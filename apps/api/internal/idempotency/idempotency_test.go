@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Canned replies of the mock deployment
+var (
+	duplicateKey = mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key error"})
+	inserted     = mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1})
+)
+
+// updated is the reply to an update that matched and modified n documents.
+func updated(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// found is the reply to a FindOne returning recs.
+func found(t *testing.T, recs ...Record) bson.D {
+	t.Helper()
+	docs := make([]bson.D, len(recs))
+	for i, rec := range recs {
+		raw, err := bson.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bson.Unmarshal(raw, &docs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return mtest.CreateCursorResponse(0, "test."+CollectionName, mtest.FirstBatch, docs...)
+}
+
+func TestReserve(t *testing.T) {
+	const fp = "fingerprint"
+	now := time.Now()
+	existing := func(status, fingerprint string, lockedUntil time.Time) Record {
+		return Record{
+			ID: recordID("42", "key"), UserID: "42", Key: "key", Fingerprint: fingerprint,
+			Status: status, Lease: "old-lease", LockedUntil: lockedUntil,
+			ResponseStatus: 201, ResponseBody: []byte(`{"task_id":"1"}`),
+		}
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tests := []struct {
+		name        string
+		replies     func(t *testing.T) []bson.D
+		wantReserve bool
+		wantReplay  bool
+		wantErr     error
+	}{
+		{"first use", func(*testing.T) []bson.D { return []bson.D{inserted} }, true, false, nil},
+		{"completed: replay", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t, existing(StatusCompleted, fp, now.Add(-time.Hour)))}
+		}, false, true, nil},
+		{"completed with another body", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t, existing(StatusCompleted, "other", now.Add(-time.Hour)))}
+		}, false, false, ErrMismatch},
+		{"in progress with another body", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t, existing(StatusProcessing, "other", now.Add(time.Minute)))}
+		}, false, false, ErrMismatch},
+		{"in progress", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t, existing(StatusProcessing, fp, now.Add(time.Minute)))}
+		}, false, false, ErrInProgress},
+		{"expired lease: take over", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t, existing(StatusProcessing, fp, now.Add(-time.Second))), updated(1)}
+		}, true, false, nil},
+		{"expired lease taken over by another retry", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t, existing(StatusProcessing, fp, now.Add(-time.Second))), updated(0)}
+		}, false, false, ErrInProgress},
+		{"released meanwhile", func(t *testing.T) []bson.D {
+			return []bson.D{duplicateKey, found(t)}
+		}, false, false, ErrInProgress},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.replies(mt.T)...)
+			store := NewStore(mt.DB, 24*time.Hour)
+
+			reservation, replay, err := store.Reserve(context.Background(), "42", "key", fp)
+			if !errors.Is(err, tt.wantErr) || (reservation != nil) != tt.wantReserve || (replay != nil) != tt.wantReplay {
+				mt.Fatalf("Reserve = %v, %v, %v, want reservation %v, replay %v, error %v",
+					reservation, replay, err, tt.wantReserve, tt.wantReplay, tt.wantErr)
+			}
+			if replay != nil && (replay.ResponseStatus != 201 || string(replay.ResponseBody) != `{"task_id":"1"}`) {
+				mt.Errorf("replay = %d %s, want the stored response", replay.ResponseStatus, replay.ResponseBody)
+			}
+			if reservation == nil || reservation.lease == "old-lease" {
+				return
+			}
+
+			// A takeover must only replace the lease it saw expire
+			for _, started := range mt.GetAllStartedEvents() {
+				if started.CommandName != "update" {
+					continue
+				}
+				filter := started.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+				if lease := filter.Lookup("lease").StringValue(); lease != "old-lease" {
+					mt.Errorf("takeover filter lease = %q, want old-lease", lease)
+				}
+			}
+		})
+	}
+}
+
+func TestReservationComplete(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tests := []struct {
+		name    string
+		reply   bson.D
+		wantErr error
+	}{
+		{"lease held", updated(1), nil},
+		{"lease lost", updated(0), ErrLeaseLost},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(inserted, tt.reply)
+			reservation, _, err := NewStore(mt.DB, time.Hour).Reserve(context.Background(), "42", "key", "fp")
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if err := reservation.Complete(context.Background(), 201, []byte(`{}`)); !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("Complete error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Fingerprint("POST", "/tasks", []byte(`{"a":1}`))
+	if Fingerprint("POST", "/tasks", []byte(`{"a":1}`)) != base {
+		t.Fatal("Fingerprint is not deterministic")
+	}
+	for _, other := range []string{
+		Fingerprint("PUT", "/tasks", []byte(`{"a":1}`)),
+		Fingerprint("POST", "/webhooks", []byte(`{"a":1}`)),
+		Fingerprint("POST", "/tasks", []byte(`{"a":2}`)),
+	} {
+		if other == base {
+			t.Error("different requests share a fingerprint")
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// retryDelay is the pause before a failed event is handled again
+const retryDelay = 5 * time.Second
+
+// TaskEventConsumer reads the task lifecycle events published by the worker.
+type TaskEventConsumer struct {
+	reader *kafka.Reader
+}
+
+// NewTaskEventConsumer creates a consumer for the "task-events" topic.
+// groupID: Consumer group; each group receives every event once
+func NewTaskEventConsumer(brokers []string, groupID string) *TaskEventConsumer {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  brokers,
+		Topic:    events.TopicTaskEvents,
+		GroupID:  groupID,
+		MinBytes: 1,
+		MaxBytes: 10e6, // 10MB
+	})
+	return &TaskEventConsumer{reader: reader}
+}
+
+// Consume passes each event to handler until ctx is cancelled. The handler's ctx
+// carries the trace context from the message headers.
+//
+// Offsets are committed only after handler succeeds; a failing handler is retried
+// with the same event (after retryDelay), so it must be idempotent. Malformed
+// events are logged and skipped.
+func (c *TaskEventConsumer) Consume(ctx context.Context, handler func(context.Context, events.TaskLifecycleEvent) error) {
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Info("Failed to read task event: " + err.Error())
+			continue
+		}
+
+		c.handle(ctx, m, handler)
+		if ctx.Err() != nil {
+			return // Not committed; the event is redelivered after restart
+		}
+
+		if err := c.reader.CommitMessages(ctx, m); err != nil {
+			slog.Error("Failed to commit task event offset", "offset", m.Offset, "error", err)
+		}
+	}
+}
+
+// handle runs handler until it succeeds or ctx is cancelled.
+func (c *TaskEventConsumer) handle(ctx context.Context, m kafka.Message, handler func(context.Context, events.TaskLifecycleEvent) error) {
+	event, err := events.DecodeTaskLifecycleEvent(m.Value)
+	if err != nil {
+		slog.Warn("Skipping malformed task event", "offset", m.Offset, "error", err)
+		return
+	}
+
+	// Extract Trace Context
+	carrier := propagation.MapCarrier{}
+	for _, h := range m.Headers {
+		carrier[h.Key] = string(h.Value)
+	}
+	eventCtx := otel.GetTextMapPropagator().Extract(ctx, carrier)
+
+	for {
+		err := handler(eventCtx, event)
+		if err == nil {
+			return
+		}
+		slog.Error("Failed to handle task event, retrying", "task_id", event.TaskID, "status", event.Status, "error", err)
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close closes the consumer connection.
+func (c *TaskEventConsumer) Close() {
+	if err := c.reader.Close(); err != nil {
+		slog.Error("Failed to close Kafka reader", "error", err)
+	}
+}
@@ -0,0 +1,45 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/segmentio/kafka-go"
+)
+
+// TestTaskEventConsumerDecodesWorkerEvents feeds the worker's encoded lifecycle
+// event (pinned by the worker's tests) through the consumer.
+func TestTaskEventConsumerDecodesWorkerEvents(t *testing.T) {
+	payload, err := os.ReadFile("../../../../pkg/events/testdata/task_lifecycle_event.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []events.TaskLifecycleEvent
+	c := &TaskEventConsumer{}
+	c.handle(context.Background(), kafka.Message{Value: payload}, func(_ context.Context, e events.TaskLifecycleEvent) error {
+		got = append(got, e)
+		return nil
+	})
+
+	if len(got) != 1 {
+		t.Fatalf("handler called %d times, want 1", len(got))
+	}
+	e := got[0]
+	started := time.Date(2024, 10, 1, 12, 0, 1, 0, time.UTC)
+	if e.SchemaVersion != events.TaskLifecycleEventVersion ||
+		e.TaskID != "652f1c0e8b3e4a0001a1b2c3" ||
+		e.UserID != "42" ||
+		e.Status != events.StatusCompleted ||
+		!e.OccurredAt.Equal(time.Date(2024, 10, 1, 12, 0, 3, 0, time.UTC)) ||
+		!e.CreatedAt.Equal(time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)) ||
+		e.StartedAt == nil || !e.StartedAt.Equal(started) ||
+		e.DurationMs != 2000 ||
+		e.ProcessedKey != "processed/652f1c0e8b3e4a0001a1b2c3.jpg" ||
+		e.ProcessedURL != "https://storage.example.com/processed/652f1c0e8b3e4a0001a1b2c3.jpg?sig=abc" {
+		t.Errorf("decoded event = %+v", e)
+	}
+}
@@ -2,15 +2,16 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"time"
 
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"github.com/segmentio/kafka-go"
 )
 
+// TopicImageTasks is the topic consumed by the worker service.
+const TopicImageTasks = "image-tasks"
+
 // Producer handles sending messages to Kafka.
 type Producer struct {
 	writer *kafka.Writer
@@ -30,37 +31,22 @@ func NewProducer(brokers []string, topic string) *Producer {
 	return &Producer{writer: writer}
 }
 
-// TaskEvent represents the message sent to Kafka.
-type TaskEvent struct {
-	TaskID   string `json:"task_id"`
-	UserID   string `json:"user_id"`
-	ImageURL string `json:"image_url"`
-}
-
-// PublishTask sends a task event to Kafka.
-func (p *Producer) PublishTask(ctx context.Context, event TaskEvent) error {
-	payload, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	// Inject Trace Context
-	carrier := propagation.MapCarrier{}
-	otel.GetTextMapPropagator().Inject(ctx, carrier)
-
-	headers := make([]kafka.Header, 0, len(carrier))
-	for k, v := range carrier {
-		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+// PublishMessage sends an already-serialized message to Kafka.
+// headers: Trace context (and any other metadata) to attach to the message
+func (p *Producer) PublishMessage(ctx context.Context, key string, value []byte, headers map[string]string) error {
+	kafkaHeaders := make([]kafka.Header, 0, len(headers))
+	for k, v := range headers {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: k, Value: []byte(v)})
 	}
 
 	// Write message with a timeout
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	err = p.writer.WriteMessages(ctx, kafka.Message{
-		Key:     []byte(event.TaskID), // Key ensures ordering for same task (if needed)
-		Value:   payload,
-		Headers: headers,
+	err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(key), // Key ensures ordering for same task (if needed)
+		Value:   value,
+		Headers: kafkaHeaders,
 	})
 
 	if err != nil {
@@ -68,7 +54,7 @@ func (p *Producer) PublishTask(ctx context.Context, event TaskEvent) error {
 		return err
 	}
 
-	fmt.Printf("Published task event: %s\n", event.TaskID)
+	fmt.Printf("Published message: %s\n", key)
 	return nil
 }
 
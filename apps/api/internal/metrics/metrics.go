@@ -39,6 +39,63 @@ var (
 		},
 	)
 
+	StreamSubscribers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_stream_subscribers",
+			Help: "Number of open task status streams (SSE connections)",
+		},
+	)
+
+	WebhookDeliveriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_webhook_deliveries_total",
+			Help: "Total number of webhook delivery attempts by outcome",
+		},
+		[]string{"result"}, // success, retry, failure
+	)
+
+	// Auth Metrics
+	AuthVerificationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_auth_verifications_total",
+			Help: "Total number of access token verifications by result",
+		},
+		[]string{"result"}, // valid, invalid, revoked, unavailable
+	)
+
+	JWKSRefreshesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_jwks_refreshes_total",
+			Help: "Total number of JWKS fetches from the Auth Service",
+		},
+		[]string{"status"}, // success, failure
+	)
+
+	// Rate Limit Metrics
+	RateLimitRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_rate_limit_rejections_total",
+			Help: "Total number of task creations rejected by rate limits and quotas",
+		},
+		[]string{"reason"}, // rate, daily_quota, monthly_quota
+	)
+
+	RateLimitStoreErrorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "api_rate_limit_store_errors_total",
+			Help: "Total number of failed rate limit store calls (requests are allowed)",
+		},
+	)
+
+	// Idempotency Metrics
+	IdempotentRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_idempotent_requests_total",
+			Help: "Total number of requests carrying an Idempotency-Key by outcome",
+		},
+		[]string{"result"}, // new, replayed, mismatch, in_progress
+	)
+
 	// Kafka Metrics
 	KafkaMessagesPublishedTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -53,4 +110,11 @@ var (
 			Help: "Total number of errors when publishing to Kafka",
 		},
 	)
+
+	OutboxMessagesParkedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "api_outbox_messages_parked_total",
+			Help: "Total number of outbox messages parked because no publisher handles their topic",
+		},
+	)
 )
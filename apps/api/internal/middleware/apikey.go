@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+)
+
+// errAuthUnavailable is returned when the Auth Service cannot validate an API key
+var errAuthUnavailable = errors.New("auth service unavailable")
+
+// apiKeyIdentity is what the Auth Service reports for a valid API key.
+type apiKeyIdentity struct {
+	UserID   string   `json:"user_id"`
+	Scopes   []string `json:"scopes"`
+	APIKeyID uint     `json:"api_key_id"`
+}
+
+type apiKeyEntry struct {
+	identity *apiKeyIdentity // Nil for invalid keys
+	expires  time.Time
+}
+
+// authenticateAPIKey handles requests with an X-API-Key header. API keys are opaque and
+// stored only in the Auth Service, so they are validated there; results (valid and
+// invalid) are cached for APIKeyCacheTTL.
+func (m *AuthMiddleware) authenticateAPIKey(c *gin.Context, key string) {
+	identity, err := m.apiKeyIdentity(c.Request.Context(), key)
+	if errors.Is(err, errAuthUnavailable) {
+		metrics.AuthVerificationsTotal.WithLabelValues("unavailable").Inc()
+		c.JSON(503, gin.H{"error": "Auth service unavailable"})
+		c.Abort()
+		return
+	}
+	if identity == nil {
+		metrics.AuthVerificationsTotal.WithLabelValues("invalid").Inc()
+		c.JSON(401, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	metrics.AuthVerificationsTotal.WithLabelValues("valid").Inc()
+
+	// Store user ID and scopes in context, like for access tokens
+	c.Set("userID", identity.UserID)
+	c.Set("scopes", identity.Scopes)
+	c.Set("apiKeyID", identity.APIKeyID)
+	c.Next()
+}
+
+// apiKeyIdentity returns the identity for key, or nil if the key is invalid.
+func (m *AuthMiddleware) apiKeyIdentity(ctx context.Context, key string) (*apiKeyIdentity, error) {
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := hex.EncodeToString(sum[:]) // The raw key is never kept in memory
+
+	now := time.Now()
+	m.mu.Lock()
+	entry, ok := m.apiKeys[cacheKey]
+	m.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.identity, nil
+	}
+
+	identity, err := m.validateAPIKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.apiKeys) >= maxRevocationCacheSize {
+		for k, e := range m.apiKeys {
+			if now.After(e.expires) {
+				delete(m.apiKeys, k)
+			}
+		}
+	}
+	if len(m.apiKeys) < maxRevocationCacheSize {
+		m.apiKeys[cacheKey] = apiKeyEntry{identity: identity, expires: now.Add(m.cfg.APIKeyCacheTTL)}
+	}
+	return identity, nil
+}
+
+// validateAPIKey asks the Auth Service's /validate endpoint about key.
+func (m *AuthMiddleware) validateAPIKey(ctx context.Context, key string) (*apiKeyIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.authServiceURL+"/validate", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", key)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var identity apiKeyIdentity
+		if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+			return nil, fmt.Errorf("%w: %v", errAuthUnavailable, err)
+		}
+		return &identity, nil
+	case http.StatusUnauthorized:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: unexpected status %d", errAuthUnavailable, resp.StatusCode)
+	}
+}
@@ -1,36 +1,83 @@
 package middleware
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+	"github.com/sanjain/pixelflow/pkg/jwks"
 )
 
-// AuthMiddleware validates JWT tokens by calling the Auth Service via HTTP
+// clockSkew is the leeway allowed on exp/iat between the Auth Service and this service.
+const clockSkew = 30 * time.Second
+
+// maxRevocationCacheSize bounds the revocation and API key caches; expired entries are swept past it.
+const maxRevocationCacheSize = 10000
+
+// Claims are the access token claims issued by the Auth Service.
+type Claims struct {
+	UserID    string   `json:"user_id"`
+	SessionID string   `json:"sid"`
+	Roles     []string `json:"roles,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AuthConfig configures token verification.
+type AuthConfig struct {
+	JWKSRefreshInterval time.Duration // How often the public keys are refetched
+	RevocationCheck     bool          // Also ask the Auth Service whether the token's session was revoked (logout)
+	RevocationCacheTTL  time.Duration // How long a session's revocation status is cached
+	APIKeyCacheTTL      time.Duration // How long an API key validation result is cached
+}
+
+// AuthMiddleware verifies JWT access tokens locally against the Auth Service's
+// public keys (JWKS), so requests do not depend on the Auth Service being up.
+// Requests may instead carry a personal API key in X-API-Key.
 type AuthMiddleware struct {
 	authServiceURL string
+	cfg            AuthConfig
+	keys           *KeyCache
 	httpClient     *http.Client
+
+	mu          sync.Mutex
+	revocations map[string]revocationEntry // By session ID
+	apiKeys     map[string]apiKeyEntry     // By SHA-256 of the key
 }
 
-// ValidateResponse represents the response from auth service
-type ValidateResponse struct {
-	Valid  bool   `json:"valid"`
-	UserID string `json:"user_id"`
+type revocationEntry struct {
+	revoked bool
+	expires time.Time
 }
 
-// NewAuthMiddleware creates a new AuthMiddleware instance
-func NewAuthMiddleware(authServiceURL string) (*AuthMiddleware, error) {
+// NewAuthMiddleware creates a new AuthMiddleware instance.
+// Keys are fetched by Run, which must be started before serving requests.
+func NewAuthMiddleware(authServiceURL string, cfg AuthConfig) (*AuthMiddleware, error) {
 	return &AuthMiddleware{
 		authServiceURL: authServiceURL,
+		cfg:            cfg,
+		keys:           NewKeyCache(authServiceURL+"/.well-known/jwks.json", cfg.JWKSRefreshInterval),
 		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout: 2 * time.Second,
 		},
+		revocations: make(map[string]revocationEntry),
+		apiKeys:     make(map[string]apiKeyEntry),
 	}, nil
 }
 
+// Run keeps the public keys fresh until ctx is cancelled.
+func (m *AuthMiddleware) Run(ctx context.Context) {
+	m.keys.Run(ctx)
+}
+
 // Close cleans up resources
 func (m *AuthMiddleware) Close() error {
 	return nil
@@ -39,10 +86,16 @@ func (m *AuthMiddleware) Close() error {
 // Middleware returns a Gin middleware handler that validates JWT tokens
 func (m *AuthMiddleware) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API keys (scripts) take precedence over the Authorization header
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			m.authenticateAPIKey(c, key)
+			return
+		}
+
 		// Extract token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "Authorization header required"})
+			c.JSON(401, gin.H{"error": "Authorization header or X-API-Key required"})
 			c.Abort()
 			return
 		}
@@ -56,39 +109,121 @@ func (m *AuthMiddleware) Middleware() gin.HandlerFunc {
 
 		token := parts[1]
 
-		// Call Auth Service HTTP endpoint to validate token
-		req, _ := http.NewRequest("GET", m.authServiceURL+"/validate", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
-
-		resp, err := m.httpClient.Do(req)
-		if err != nil {
+		// Verify signature and expiry locally
+		claims, err := m.verify(c.Request.Context(), token)
+		if errors.Is(err, ErrKeysUnavailable) {
+			metrics.AuthVerificationsTotal.WithLabelValues("unavailable").Inc()
 			c.JSON(503, gin.H{"error": "Auth service unavailable"})
 			c.Abort()
 			return
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
+		if err != nil {
+			metrics.AuthVerificationsTotal.WithLabelValues("invalid").Inc()
 			c.JSON(401, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		var validateResp ValidateResponse
-		if err := json.NewDecoder(resp.Body).Decode(&validateResp); err != nil {
-			c.JSON(500, gin.H{"error": "Failed to parse auth response"})
+		// Optional revocation check (logged-out sessions)
+		if m.cfg.RevocationCheck && m.revoked(c.Request.Context(), token, claims.SessionID) {
+			metrics.AuthVerificationsTotal.WithLabelValues("revoked").Inc()
+			c.JSON(401, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		if !validateResp.Valid {
-			c.JSON(401, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+		metrics.AuthVerificationsTotal.WithLabelValues("valid").Inc()
 
-		// Store user ID in context
-		c.Set("userID", validateResp.UserID)
+		// Store user ID, roles and scopes in context
+		c.Set("userID", claims.UserID)
+		c.Set("roles", claims.Roles)
+		c.Set("scopes", claims.Scopes)
 		c.Next()
 	}
 }
+
+// verify parses the token and checks its signature against the key named by its kid.
+func (m *AuthMiddleware) verify(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := m.keys.Lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		// The algorithm is bound to the key, never taken from the token alone
+		if t.Method.Alg() != key.alg {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.key, nil
+	},
+		jwt.WithValidMethods([]string{jwks.AlgRS256, jwks.AlgEdDSA}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" || claims.SessionID == "" {
+		return nil, errors.New("missing claims")
+	}
+	return claims, nil
+}
+
+// revoked reports whether the token's session was revoked, asking the Auth Service's
+// /validate endpoint at most once per session per RevocationCacheTTL.
+// If the Auth Service cannot be reached the token is accepted (fail open): it was
+// already verified locally and expires within one access token TTL.
+func (m *AuthMiddleware) revoked(ctx context.Context, token, sessionID string) bool {
+	now := time.Now()
+	m.mu.Lock()
+	entry, ok := m.revocations[sessionID]
+	m.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.revoked
+	}
+
+	revoked, err := m.checkRevocation(ctx, token)
+	if err != nil {
+		slog.Warn("Revocation check failed, accepting locally verified token", "error", err)
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.revocations) >= maxRevocationCacheSize {
+		for sid, e := range m.revocations {
+			if now.After(e.expires) {
+				delete(m.revocations, sid)
+			}
+		}
+	}
+	if len(m.revocations) < maxRevocationCacheSize {
+		m.revocations[sessionID] = revocationEntry{revoked: revoked, expires: now.Add(m.cfg.RevocationCacheTTL)}
+	}
+	return revoked
+}
+
+// checkRevocation calls the Auth Service's /validate endpoint, which also checks the session.
+func (m *AuthMiddleware) checkRevocation(ctx context.Context, token string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.authServiceURL+"/validate", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return false, nil
+	case http.StatusUnauthorized:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
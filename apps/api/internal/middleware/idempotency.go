@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/idempotency"
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client's idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Limits on idempotent requests
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 1 << 20 // Bodies are read into memory to fingerprint them
+	idempotencyStoreTimeout = 5 * time.Second
+)
+
+// Idempotency makes a route safe to retry: a repeated request with the same
+// Idempotency-Key and body gets the original response instead of running again.
+// Requests without the header are passed through unchanged.
+// It must run after AuthMiddleware.Middleware (keys are per user), and the handler
+// must complete the reservation stored under idempotency.ContextKey when it succeeds.
+type Idempotency struct {
+	store *idempotency.Store
+}
+
+// NewIdempotency creates a new Idempotency middleware.
+func NewIdempotency(store *idempotency.Store) *Idempotency {
+	return &Idempotency{store: store}
+}
+
+// Middleware returns a Gin middleware handler that reserves or replays the request's key.
+func (m *Idempotency) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be 1-255 printable ASCII characters"})
+			return
+		}
+		userID := c.GetString("userID")
+
+		// 1. Fingerprint the request, then hand the body on to the handler
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body is too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.FullPath(), body)
+
+		// 2. Reserve the key, or replay / reject a repeat
+		reservation, replay, err := m.store.Reserve(c.Request.Context(), userID, key, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrMismatch):
+			metrics.IdempotentRequestsTotal.WithLabelValues("mismatch").Inc()
+			slog.Warn("Idempotency key reused with a different request", "user_id", userID, "key", key)
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			return
+		case errors.Is(err, idempotency.ErrInProgress):
+			metrics.IdempotentRequestsTotal.WithLabelValues("in_progress").Inc()
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			return
+		case err != nil:
+			slog.Error("Failed to reserve idempotency key", "user_id", userID, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		case replay != nil:
+			metrics.IdempotentRequestsTotal.WithLabelValues("replayed").Inc()
+			slog.Info("Replaying idempotent response", "user_id", userID, "key", key)
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(replay.ResponseStatus, "application/json; charset=utf-8", replay.ResponseBody)
+			c.Abort()
+			return
+		}
+		metrics.IdempotentRequestsTotal.WithLabelValues("new").Inc()
+
+		// 3. Run the handler, then free the key again if it did not complete it
+		c.Set(idempotency.ContextKey, reservation)
+		c.Next()
+
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), idempotencyStoreTimeout)
+		defer cancel()
+		if err := reservation.Release(releaseCtx); err != nil {
+			// The lease expires on its own; retries wait until then
+			slog.Warn("Failed to release idempotency key", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// validIdempotencyKey accepts the printable ASCII keys clients generate (usually UUIDs).
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
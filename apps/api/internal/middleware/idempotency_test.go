@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/idempotency"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// storedRecord is the reply to the lookup of an existing idempotency record.
+func storedRecord(t *testing.T, rec idempotency.Record) bson.D {
+	t.Helper()
+	raw, err := bson.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return mtest.CreateCursorResponse(0, "test."+idempotency.CollectionName, mtest.FirstBatch, doc)
+}
+
+func TestIdempotency(t *testing.T) {
+	const body = `{"image_url":"https://example.com/cat.jpg"}`
+	fingerprint := idempotency.Fingerprint(http.MethodPost, "/tasks", []byte(body))
+	record := func(status, fp string, lockedUntil time.Time) idempotency.Record {
+		return idempotency.Record{
+			ID: "42:key-1", UserID: "42", Key: "key-1", Fingerprint: fp, Status: status,
+			LockedUntil: lockedUntil, ResponseStatus: http.StatusCreated, ResponseBody: []byte(`{"task_id":"abc"}`),
+		}
+	}
+	duplicateKey := mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "E11000 duplicate key error"})
+	ok := mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1})
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	tests := []struct {
+		name        string
+		key         string
+		body        string
+		replies     func(t *testing.T) []bson.D
+		wantStatus  int
+		wantBody    string
+		wantHandled bool // The handler ran
+		wantHeader  [2]string
+	}{
+		{
+			name: "no key", key: "", body: body,
+			replies:    func(*testing.T) []bson.D { return nil },
+			wantStatus: http.StatusCreated, wantBody: `{"task_id":"new"}`, wantHandled: true,
+		},
+		{
+			name: "invalid key", key: "café", body: body,
+			replies:    func(*testing.T) []bson.D { return nil },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "key too long", key: strings.Repeat("k", 256), body: body,
+			replies:    func(*testing.T) []bson.D { return nil },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			// Insert, complete by the handler, release (a no-op once completed)
+			name: "first use", key: "key-1", body: body,
+			replies:    func(*testing.T) []bson.D { return []bson.D{ok, ok, ok} },
+			wantStatus: http.StatusCreated, wantBody: `{"task_id":"new"}`, wantHandled: true,
+		},
+		{
+			name: "replay", key: "key-1", body: body,
+			replies: func(t *testing.T) []bson.D {
+				return []bson.D{duplicateKey, storedRecord(t, record(idempotency.StatusCompleted, fingerprint, time.Now()))}
+			},
+			wantStatus: http.StatusCreated, wantBody: `{"task_id":"abc"}`,
+			wantHeader: [2]string{"Idempotent-Replayed", "true"},
+		},
+		{
+			name: "different body", key: "key-1", body: `{"image_url":"https://example.com/dog.jpg"}`,
+			replies: func(t *testing.T) []bson.D {
+				return []bson.D{duplicateKey, storedRecord(t, record(idempotency.StatusCompleted, fingerprint, time.Now()))}
+			},
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name: "in progress", key: "key-1", body: body,
+			replies: func(t *testing.T) []bson.D {
+				return []bson.D{duplicateKey, storedRecord(t, record(idempotency.StatusProcessing, fingerprint, time.Now().Add(time.Minute)))}
+			},
+			wantStatus: http.StatusConflict,
+			wantHeader: [2]string{"Retry-After", "1"},
+		},
+		{
+			// Take over, complete by the handler, release
+			name: "expired lease", key: "key-1", body: body,
+			replies: func(t *testing.T) []bson.D {
+				return []bson.D{duplicateKey, storedRecord(t, record(idempotency.StatusProcessing, fingerprint, time.Now().Add(-time.Second))), ok, ok, ok}
+			},
+			wantStatus: http.StatusCreated, wantBody: `{"task_id":"new"}`, wantHandled: true,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.replies(mt.T)...)
+			m := NewIdempotency(idempotency.NewStore(mt.DB, 24*time.Hour))
+
+			handled := false
+			router := gin.New()
+			router.POST("/tasks", func(c *gin.Context) {
+				c.Set("userID", "42")
+			}, m.Middleware(), func(c *gin.Context) {
+				handled = true
+				// The handler still sees the whole body
+				if got, _ := io.ReadAll(c.Request.Body); string(got) != tt.body {
+					mt.Errorf("handler body = %s, want %s", got, tt.body)
+				}
+				if r, ok := c.Get(idempotency.ContextKey); ok {
+					if err := r.(*idempotency.Reservation).Complete(c.Request.Context(), http.StatusCreated, []byte(`{"task_id":"new"}`)); err != nil {
+						mt.Errorf("Complete: %v", err)
+					}
+				}
+				c.Data(http.StatusCreated, "application/json", []byte(`{"task_id":"new"}`))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(tt.body))
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus || handled != tt.wantHandled {
+				mt.Fatalf("status %d, handled %v, want %d, %v (body %s)", w.Code, handled, tt.wantStatus, tt.wantHandled, w.Body)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				mt.Errorf("body = %s, want %s", w.Body, tt.wantBody)
+			}
+			if tt.key != "" && tt.wantHandled {
+				// The reservation is released once the handler returns
+				started := mt.GetAllStartedEvents()
+				if last := started[len(started)-1].CommandName; last != "delete" {
+					mt.Errorf("last command = %s, want delete (release)", last)
+				}
+			}
+			if h := tt.wantHeader; h[0] != "" && w.Header().Get(h[0]) != h[1] {
+				mt.Errorf("%s = %q, want %q", h[0], w.Header().Get(h[0]), h[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+	"github.com/sanjain/pixelflow/pkg/jwks"
+)
+
+// minRefetchInterval rate-limits JWKS fetches triggered by unknown key IDs,
+// so tokens with made-up kids cannot hammer the Auth Service.
+const minRefetchInterval = 10 * time.Second
+
+var (
+	// ErrUnknownKey is returned for a kid that is not in the auth service's JWKS
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrKeysUnavailable is returned when no keys could be fetched yet
+	ErrKeysUnavailable = errors.New("signing keys unavailable")
+)
+
+// publicKey is a verification key from the JWKS.
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// KeyCache holds the Auth Service's public keys for local token verification.
+// Keys are refreshed in the background, and on demand when a token names a key
+// that is not cached yet (the Auth Service rotated its signing key).
+type KeyCache struct {
+	url             string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+
+	mu   sync.RWMutex
+	keys map[string]publicKey // By kid
+
+	fetchMu   sync.Mutex // Serializes fetches
+	lastFetch time.Time
+}
+
+// NewKeyCache creates a KeyCache for the JWKS at url.
+func NewKeyCache(url string, refreshInterval time.Duration) *KeyCache {
+	return &KeyCache{
+		url:             url,
+		httpClient:      &http.Client{Timeout: 5 * time.Second},
+		refreshInterval: refreshInterval,
+		keys:            make(map[string]publicKey),
+	}
+}
+
+// Run fetches the keys and refreshes them every refreshInterval until ctx is cancelled.
+// While the Auth Service is unreachable the last fetched keys stay in use; until the
+// first successful fetch it is retried more often.
+func (kc *KeyCache) Run(ctx context.Context) {
+	for {
+		wait := kc.refreshInterval
+		if err := kc.fetch(ctx); err != nil {
+			slog.Warn("Failed to fetch JWKS", "url", kc.url, "error", err)
+			if kc.empty() {
+				wait = min(wait, 5*time.Second)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Lookup returns the verification key for kid, refetching the JWKS if it is unknown.
+func (kc *KeyCache) Lookup(ctx context.Context, kid string) (publicKey, error) {
+	if key, ok := kc.get(kid); ok {
+		return key, nil
+	}
+
+	// Unknown kid: the signing key may have just rotated
+	kc.fetchMu.Lock()
+	if time.Since(kc.lastFetch) >= minRefetchInterval {
+		kc.fetchLocked(ctx)
+	}
+	kc.fetchMu.Unlock()
+
+	if key, ok := kc.get(kid); ok {
+		return key, nil
+	}
+	if kc.empty() {
+		return publicKey{}, ErrKeysUnavailable
+	}
+	return publicKey{}, ErrUnknownKey
+}
+
+func (kc *KeyCache) get(kid string) (publicKey, bool) {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+	key, ok := kc.keys[kid]
+	return key, ok
+}
+
+func (kc *KeyCache) empty() bool {
+	kc.mu.RLock()
+	defer kc.mu.RUnlock()
+	return len(kc.keys) == 0
+}
+
+func (kc *KeyCache) fetch(ctx context.Context) error {
+	kc.fetchMu.Lock()
+	defer kc.fetchMu.Unlock()
+	return kc.fetchLocked(ctx)
+}
+
+// fetchLocked downloads the JWKS and replaces the cached keys. Keys dropped from the
+// JWKS (expired after a rotation) are dropped here too. Callers hold fetchMu.
+func (kc *KeyCache) fetchLocked(ctx context.Context) error {
+	kc.lastFetch = time.Now()
+	keys, err := kc.download(ctx)
+	if err != nil {
+		metrics.JWKSRefreshesTotal.WithLabelValues("failure").Inc()
+		return err
+	}
+	metrics.JWKSRefreshesTotal.WithLabelValues("success").Inc()
+
+	kc.mu.Lock()
+	kc.keys = keys
+	kc.mu.Unlock()
+	return nil
+}
+
+func (kc *KeyCache) download(ctx context.Context) (map[string]publicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, kc.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set jwks.Set
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.PublicKey()
+		if err != nil {
+			// Skip keys this service cannot use rather than failing the whole set
+			slog.Warn("Ignoring JWKS key", "kid", k.Kid, "error", err)
+			continue
+		}
+		keys[k.Kid] = publicKey{alg: k.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no usable keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/api/internal/ratelimit"
+)
+
+// storeTimeout bounds a rate limit store call, so a slow Redis cannot stall uploads
+const storeTimeout = 500 * time.Millisecond
+
+// RateLimitConfig configures per-user limits on task creation. Zero disables a limit.
+type RateLimitConfig struct {
+	RatePerMinute float64 // Sustained task creations per minute
+	Burst         int     // Task creations allowed at once
+	DailyQuota    int64   // Tasks per user per UTC day
+	MonthlyQuota  int64   // Tasks per user per UTC calendar month
+}
+
+// RateLimiter limits how fast and how many tasks each user creates, so one user
+// cannot flood the shared task queue. It must run after AuthMiddleware.Middleware,
+// which stores the user ID in the context.
+type RateLimiter struct {
+	store ratelimit.Store
+	cfg   RateLimitConfig
+}
+
+// NewRateLimiter creates a new RateLimiter.
+func NewRateLimiter(store ratelimit.Store, cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{store: store, cfg: cfg}
+}
+
+// Middleware returns a Gin middleware handler that applies the rate limit and quotas.
+// Quota usage is refunded when the request fails, so rejected uploads do not count.
+// If the store is unavailable requests are let through (fail open).
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		ctx, cancel := context.WithTimeout(c.Request.Context(), storeTimeout)
+		defer cancel()
+
+		// 1. Rate (token bucket)
+		if l.cfg.RatePerMinute > 0 && l.cfg.Burst > 0 {
+			bucket := ratelimit.Bucket{Rate: l.cfg.RatePerMinute / 60, Burst: l.cfg.Burst}
+			res, err := l.store.Take(ctx, rateKey(userID), bucket)
+			if err != nil {
+				metrics.RateLimitStoreErrorsTotal.Inc()
+				slog.Warn("Rate limit check failed, allowing request", "user_id", userID, "error", err)
+			} else {
+				c.Header("X-RateLimit-Limit", strconv.Itoa(l.cfg.Burst))
+				c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+				c.Header("X-RateLimit-Reset", ceilSeconds(res.ResetAfter))
+				if !res.Allowed {
+					l.reject(c, "rate", "Rate limit exceeded; slow down", res.RetryAfter)
+					return
+				}
+			}
+		}
+
+		// 2. Quotas (daily and monthly, consumed together)
+		quotas, names := l.quotas(userID, time.Now().UTC())
+		if len(quotas) == 0 {
+			c.Next()
+			return
+		}
+		res, err := l.store.Consume(ctx, quotas)
+		if err != nil {
+			metrics.RateLimitStoreErrorsTotal.Inc()
+			slog.Warn("Quota check failed, allowing request", "user_id", userID, "error", err)
+			c.Next()
+			return
+		}
+		if !res.Allowed {
+			q, name := quotas[res.Exceeded], names[res.Exceeded]
+			c.Header("X-Quota-"+name+"-Limit", strconv.FormatInt(q.Limit, 10))
+			c.Header("X-Quota-"+name+"-Remaining", "0")
+			l.reject(c, strings.ToLower(name)+"_quota", name+" task quota exceeded", time.Until(q.Reset))
+			return
+		}
+		for i, q := range quotas {
+			c.Header("X-Quota-"+names[i]+"-Limit", strconv.FormatInt(q.Limit, 10))
+			c.Header("X-Quota-"+names[i]+"-Remaining", strconv.FormatInt(max(q.Limit-res.Counts[i], 0), 10))
+		}
+
+		c.Next()
+
+		// Give the quota back if no task was created
+		if c.Writer.Status() >= 400 {
+			refundCtx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), storeTimeout)
+			defer cancel()
+			if err := l.store.Refund(refundCtx, quotas); err != nil {
+				metrics.RateLimitStoreErrorsTotal.Inc()
+				slog.Warn("Failed to refund quota", "user_id", userID, "error", err)
+			}
+		}
+	}
+}
+
+// quotas returns the user's enabled quotas for the windows containing now, with their names.
+func (l *RateLimiter) quotas(userID string, now time.Time) ([]ratelimit.Quota, []string) {
+	var quotas []ratelimit.Quota
+	var names []string
+	if l.cfg.DailyQuota > 0 {
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		quotas = append(quotas, ratelimit.Quota{
+			Key:   "ratelimit:{" + userID + "}:day:" + day.Format("2006-01-02"),
+			Limit: l.cfg.DailyQuota,
+			Reset: day.AddDate(0, 0, 1),
+		})
+		names = append(names, "Daily")
+	}
+	if l.cfg.MonthlyQuota > 0 {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		quotas = append(quotas, ratelimit.Quota{
+			Key:   "ratelimit:{" + userID + "}:month:" + month.Format("2006-01"),
+			Limit: l.cfg.MonthlyQuota,
+			Reset: month.AddDate(0, 1, 0),
+		})
+		names = append(names, "Monthly")
+	}
+	return quotas, names
+}
+
+// reject answers 429 with a Retry-After header.
+func (l *RateLimiter) reject(c *gin.Context, reason, message string, retryAfter time.Duration) {
+	metrics.RateLimitRejectionsTotal.WithLabelValues(reason).Inc()
+	slog.Warn("Request rate limited", "user_id", c.GetString("userID"), "reason", reason, "retry_after", retryAfter.String())
+	c.Header("Retry-After", ceilSeconds(retryAfter))
+	c.JSON(429, gin.H{"error": message})
+	c.Abort()
+}
+
+// rateKey names the user's token bucket. The {userID} hash tag keeps all of a
+// user's keys in one Redis Cluster slot.
+func rateKey(userID string) string {
+	return "ratelimit:{" + userID + "}:tasks"
+}
+
+// ceilSeconds formats d as whole seconds, rounded up, for HTTP headers.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(max(d, 0).Seconds())))
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/api/internal/ratelimit"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// rateLimitedRouter serves POST /tasks for user 42 behind l; the handler answers
+// with *status, as task creation would.
+func rateLimitedRouter(l *RateLimiter, status *int) *gin.Engine {
+	router := gin.New()
+	router.POST("/tasks", func(c *gin.Context) {
+		c.Set("userID", "42")
+	}, l.Middleware(), func(c *gin.Context) {
+		c.JSON(*status, gin.H{})
+	})
+	return router
+}
+
+func post(router *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tasks", nil))
+	return w
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	l := NewRateLimiter(ratelimit.NewMemoryStore(), RateLimitConfig{RatePerMinute: 1, Burst: 2})
+	status := http.StatusCreated
+	router := rateLimitedRouter(l, &status)
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := post(router)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d, want 201", i, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 2", i, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i, got, wantRemaining)
+		}
+	}
+
+	w := post(router)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst: status %d, want 429", w.Code)
+	}
+	// One token per minute: the next one is about a minute away, a full bucket two
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Reset"); got != "120" {
+		t.Errorf("X-RateLimit-Reset = %q, want 120", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+}
+
+func TestQuotaRefundedOnFailure(t *testing.T) {
+	l := NewRateLimiter(ratelimit.NewMemoryStore(), RateLimitConfig{DailyQuota: 2, MonthlyQuota: 10})
+	status := http.StatusBadRequest
+	router := rateLimitedRouter(l, &status)
+
+	// Failed requests give their quota back
+	for range 3 {
+		w := post(router)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("failing request: status %d, want 400", w.Code)
+		}
+		if got := w.Header().Get("X-Quota-Daily-Remaining"); got != "1" {
+			t.Fatalf("failing request: X-Quota-Daily-Remaining = %q, want 1", got)
+		}
+	}
+
+	status = http.StatusCreated
+	for i, want := range []string{"1", "0"} {
+		w := post(router)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d, want 201", i, w.Code)
+		}
+		if got := w.Header().Get("X-Quota-Daily-Remaining"); got != want {
+			t.Errorf("request %d: X-Quota-Daily-Remaining = %q, want %s", i, got, want)
+		}
+		if got := w.Header().Get("X-Quota-Monthly-Limit"); got != "10" {
+			t.Errorf("request %d: X-Quota-Monthly-Limit = %q, want 10", i, got)
+		}
+	}
+
+	w := post(router)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the daily quota: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("X-Quota-Daily-Remaining"); got != "0" {
+		t.Errorf("X-Quota-Daily-Remaining = %q, want 0", got)
+	}
+	// Retry once the UTC day is over
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	retry, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retry < int(time.Until(midnight).Seconds())-1 || retry > int(time.Until(midnight).Seconds())+1 {
+		t.Errorf("Retry-After = %q, want about %v", w.Header().Get("Retry-After"), time.Until(midnight))
+	}
+}
+
+func TestQuotaWindows(t *testing.T) {
+	l := NewRateLimiter(nil, RateLimitConfig{DailyQuota: 5, MonthlyQuota: 100})
+	tests := []struct {
+		now        time.Time
+		dayKey     string
+		dayReset   time.Time
+		monthKey   string
+		monthReset time.Time
+	}{
+		{
+			time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC),
+			"ratelimit:{42}:day:2024-01-31", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:month:2024-01", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:day:2024-02-01", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:month:2024-02", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:day:2024-02-29", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:month:2024-02", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			time.Date(2024, 12, 31, 18, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:day:2024-12-31", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			"ratelimit:{42}:month:2024-12", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		quotas, names := l.quotas("42", tt.now)
+		if len(quotas) != 2 || names[0] != "Daily" || names[1] != "Monthly" {
+			t.Fatalf("quotas(%v) = %v, %v", tt.now, quotas, names)
+		}
+		if q := quotas[0]; q.Key != tt.dayKey || !q.Reset.Equal(tt.dayReset) || q.Limit != 5 {
+			t.Errorf("daily quota at %v = %+v, want %s until %v", tt.now, q, tt.dayKey, tt.dayReset)
+		}
+		if q := quotas[1]; q.Key != tt.monthKey || !q.Reset.Equal(tt.monthReset) || q.Limit != 100 {
+			t.Errorf("monthly quota at %v = %+v, want %s until %v", tt.now, q, tt.monthKey, tt.monthReset)
+		}
+	}
+
+	if quotas, _ := NewRateLimiter(nil, RateLimitConfig{MonthlyQuota: 1}).quotas("42", time.Now()); len(quotas) != 1 {
+		t.Errorf("with the daily quota disabled: %d quotas, want 1", len(quotas))
+	}
+}
+
+// failingStore is a Store that is down.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Bucket) (ratelimit.BucketResult, error) {
+	return ratelimit.BucketResult{}, errors.New("connection refused")
+}
+
+func (failingStore) Consume(context.Context, []ratelimit.Quota) (ratelimit.QuotaResult, error) {
+	return ratelimit.QuotaResult{}, errors.New("connection refused")
+}
+
+func (failingStore) Refund(context.Context, []ratelimit.Quota) error {
+	return errors.New("connection refused")
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	l := NewRateLimiter(failingStore{}, RateLimitConfig{RatePerMinute: 1, Burst: 1, DailyQuota: 1})
+	status := http.StatusCreated
+	router := rateLimitedRouter(l, &status)
+	for range 3 {
+		if w := post(router); w.Code != http.StatusCreated {
+			t.Fatalf("status %d with the store down, want 201", w.Code)
+		}
+	}
+}
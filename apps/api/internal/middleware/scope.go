@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes issued by the Auth Service (see its models.DefaultRoles)
+const (
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+	ScopeAdminTasks    = "admin:tasks"
+)
+
+// RequireScope returns a Gin middleware handler that rejects requests whose token
+// does not carry scope. It must run after AuthMiddleware.Middleware, which stores
+// the token's scopes in the context.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes := c.GetStringSlice("scopes")
+		if !slices.Contains(scopes, scope) {
+			c.JSON(403, gin.H{"error": "Missing scope " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
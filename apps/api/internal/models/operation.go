@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sanjain/pixelflow/pkg/events"
+)
+
+// Supported operation names (must match the worker's imaging package)
+const (
+	OpResize    = "resize"
+	OpCrop      = "crop"
+	OpRotate    = "rotate"
+	OpFlip      = "flip"
+	OpGrayscale = "grayscale"
+)
+
+// Limits enforced on operation lists.
+// MaxDimension bounds every size and offset a client supplies. A resize with only
+// one dimension derives the other from the source's aspect ratio, which the API
+// cannot know; the worker checks every resize output against its pixel budget.
+const (
+	MaxOperations = 20
+	MaxDimension  = 10000
+)
+
+// Operation describes a single transformation step applied by the worker.
+// Only the parameters relevant to Op are used. Its fields mirror events.Operation
+// so the two convert directly when building Kafka events.
+type Operation struct {
+	Op        string `bson:"op" json:"op"`
+	Width     int    `bson:"width,omitempty" json:"width,omitempty"`
+	Height    int    `bson:"height,omitempty" json:"height,omitempty"`
+	X         int    `bson:"x,omitempty" json:"x,omitempty"`
+	Y         int    `bson:"y,omitempty" json:"y,omitempty"`
+	Angle     int    `bson:"angle,omitempty" json:"angle,omitempty"`
+	Direction string `bson:"direction,omitempty" json:"direction,omitempty"`
+}
+
+// DefaultOperations is used when an upload request does not specify any operations,
+// so every stored task still describes exactly what the worker will do.
+// It is the shared events.DefaultOperations, which the worker uses for legacy tasks.
+var DefaultOperations = func() []Operation {
+	ops := make([]Operation, len(events.DefaultOperations))
+	for i, op := range events.DefaultOperations {
+		ops[i] = Operation(op)
+	}
+	return ops
+}()
+
+// ValidateOperations checks an operation list against the supported schema.
+func ValidateOperations(ops []Operation) error {
+	if len(ops) > MaxOperations {
+		return fmt.Errorf("too many operations: %d (max %d)", len(ops), MaxOperations)
+	}
+	for i, op := range ops {
+		if err := op.Validate(); err != nil {
+			return fmt.Errorf("operations[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the operation is known and has the parameters it requires.
+func (o Operation) Validate() error {
+	switch o.Op {
+	case OpResize:
+		if o.Width < 0 || o.Height < 0 || (o.Width == 0 && o.Height == 0) {
+			return errors.New("resize requires a positive width and/or height")
+		}
+		if o.Width > MaxDimension || o.Height > MaxDimension {
+			return fmt.Errorf("resize dimensions must not exceed %d", MaxDimension)
+		}
+	case OpCrop:
+		if o.Width <= 0 || o.Height <= 0 {
+			return errors.New("crop requires a positive width and height")
+		}
+		if o.X < 0 || o.Y < 0 {
+			return errors.New("crop offsets must not be negative")
+		}
+		if o.Width > MaxDimension || o.Height > MaxDimension || o.X > MaxDimension || o.Y > MaxDimension {
+			return fmt.Errorf("crop offsets and dimensions must not exceed %d", MaxDimension)
+		}
+	case OpRotate:
+		if o.Angle%90 != 0 {
+			return errors.New("rotate angle must be a multiple of 90")
+		}
+	case OpFlip:
+		if o.Direction != "horizontal" && o.Direction != "vertical" {
+			return errors.New("flip direction must be 'horizontal' or 'vertical'")
+		}
+	case OpGrayscale:
+		// No parameters
+	case "":
+		return errors.New("op is required")
+	default:
+		return fmt.Errorf("unknown op %q", o.Op)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import "testing"
+
+func TestOperationValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      Operation
+		wantErr bool
+	}{
+		{"resize width only", Operation{Op: OpResize, Width: 800}, false},
+		{"resize at max", Operation{Op: OpResize, Width: MaxDimension, Height: MaxDimension}, false},
+		{"resize above max", Operation{Op: OpResize, Height: MaxDimension + 1}, true},
+		{"resize without dimensions", Operation{Op: OpResize}, true},
+		{"crop", Operation{Op: OpCrop, X: 10, Y: 20, Width: 100, Height: 50}, false},
+		{"crop at max", Operation{Op: OpCrop, X: MaxDimension, Y: MaxDimension, Width: MaxDimension, Height: MaxDimension}, false},
+		{"crop width above max", Operation{Op: OpCrop, Width: MaxDimension + 1, Height: 1}, true},
+		{"crop height above max", Operation{Op: OpCrop, Width: 1, Height: MaxDimension + 1}, true},
+		{"crop x above max", Operation{Op: OpCrop, X: MaxDimension + 1, Width: 1, Height: 1}, true},
+		{"crop y above max", Operation{Op: OpCrop, Y: 1 << 62, Width: 1, Height: 1}, true},
+		{"crop negative offset", Operation{Op: OpCrop, X: -1, Width: 1, Height: 1}, true},
+		{"rotate", Operation{Op: OpRotate, Angle: 270}, false},
+		{"rotate odd angle", Operation{Op: OpRotate, Angle: 45}, true},
+		{"unknown op", Operation{Op: "blur"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -14,14 +14,33 @@ const (
 	StatusProcessing TaskStatus = "PROCESSING"
 	StatusCompleted  TaskStatus = "COMPLETED"
 	StatusFailed     TaskStatus = "FAILED"
+	StatusCancelled  TaskStatus = "CANCELLED"
 )
 
+// Valid reports whether s is a known status.
+func (s TaskStatus) Valid() bool {
+	switch s {
+	case StatusPending, StatusProcessing, StatusCompleted, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether the task can no longer change status.
+func (s TaskStatus) IsTerminal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
 // Task represents an image processing task
 type Task struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
 	UserID       string             `bson:"user_id" json:"user_id"`
 	ImageURL     string             `bson:"image_url" json:"image_url"`
+	OriginalKey  string             `bson:"original_key,omitempty" json:"original_key,omitempty"` // Storage key of an uploaded original
+	Operations   []Operation        `bson:"operations" json:"operations"`
+	ProcessedKey string             `bson:"processed_key,omitempty" json:"processed_key,omitempty"` // Storage key of the output
 	ProcessedURL string             `bson:"processed_url,omitempty" json:"processed_url,omitempty"`
+	Error        string             `bson:"error,omitempty" json:"error,omitempty"` // Failure reason when Status is FAILED
 	Status       TaskStatus         `bson:"status" json:"status"`
 	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often full buckets and ended quota windows are dropped
+const sweepInterval = time.Minute
+
+// MemoryStore keeps rate limit state in process memory. Limits are per replica:
+// with N API replicas a user effectively gets N times the limits.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	counters  map[string]*memoryCounter
+	lastSweep time.Time
+	now       func() time.Time // Clock, replaced in tests
+}
+
+type memoryBucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Time // When the bucket will be full again; it can be dropped then
+}
+
+type memoryCounter struct {
+	count int64
+	reset time.Time
+}
+
+// NewMemoryStore creates a MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*memoryBucket),
+		counters:  make(map[string]*memoryCounter),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Take takes one token from the bucket named key.
+func (s *MemoryStore) Take(ctx context.Context, key string, b Bucket) (BucketResult, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(b.Burst), at: now}
+		s.buckets[key] = bucket
+	}
+
+	// Refill for the time elapsed since the last take
+	bucket.tokens = min(float64(b.Burst), bucket.tokens+now.Sub(bucket.at).Seconds()*b.Rate)
+	bucket.at = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	res := bucketResult(allowed, bucket.tokens, b)
+	bucket.full = now.Add(res.ResetAfter)
+	return res, nil
+}
+
+// Consume increments every quota by one, unless any of them is exhausted.
+func (s *MemoryStore) Consume(ctx context.Context, quotas []Quota) (QuotaResult, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	for i, q := range quotas {
+		if c := s.counters[q.Key]; c != nil && c.count >= q.Limit {
+			return QuotaResult{Exceeded: i}, nil
+		}
+	}
+
+	counts := make([]int64, len(quotas))
+	for i, q := range quotas {
+		c := s.counters[q.Key]
+		if c == nil {
+			c = &memoryCounter{reset: q.Reset}
+			s.counters[q.Key] = c
+		}
+		c.count++
+		counts[i] = c.count
+	}
+	return QuotaResult{Allowed: true, Counts: counts}, nil
+}
+
+// Refund decrements every quota by one.
+func (s *MemoryStore) Refund(ctx context.Context, quotas []Quota) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range quotas {
+		if c := s.counters[q.Key]; c != nil && c.count > 0 {
+			c.count--
+		}
+	}
+	return nil
+}
+
+// sweep drops state that no longer limits anything, at most once per sweepInterval.
+// The caller must hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.After(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, c := range s.counters {
+		if now.After(c.reset) {
+			delete(s.counters, key)
+		}
+	}
+}
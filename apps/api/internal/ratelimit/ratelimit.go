@@ -0,0 +1,89 @@
+// Package ratelimit provides the counters behind per-user rate limits and quotas:
+// token buckets for request rates and fixed-window counters for daily and monthly
+// quotas. Counters live in a Store, either in memory (one API replica) or in Redis
+// (shared by all replicas).
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Bucket configures a token bucket: it holds up to Burst tokens and refills at
+// Rate tokens per second. Each request takes one token.
+type Bucket struct {
+	Rate  float64
+	Burst int
+}
+
+// BucketResult is the state of a bucket after taking a token.
+type BucketResult struct {
+	Allowed    bool
+	Remaining  int           // Whole tokens left
+	RetryAfter time.Duration // Until the next token, when not allowed
+	ResetAfter time.Duration // Until the bucket is full again
+}
+
+// Quota is one fixed-window counter, e.g. a user's tasks today.
+type Quota struct {
+	Key   string    // Unique per user and window
+	Limit int64     // Maximum count within the window
+	Reset time.Time // End of the window
+}
+
+// QuotaResult is the outcome of consuming a set of quotas.
+type QuotaResult struct {
+	Allowed  bool
+	Exceeded int     // Index of the first exhausted quota, when not allowed
+	Counts   []int64 // Count of each quota after consuming, when allowed
+}
+
+// Store keeps rate limit state. Implementations must be safe for concurrent use,
+// and their operations atomic, so concurrent requests cannot overshoot a limit.
+type Store interface {
+	// Take takes one token from the bucket named key.
+	Take(ctx context.Context, key string, b Bucket) (BucketResult, error)
+
+	// Consume increments every quota by one, unless any of them is exhausted,
+	// in which case none is incremented.
+	Consume(ctx context.Context, quotas []Quota) (QuotaResult, error)
+
+	// Refund decrements every quota by one, e.g. when the request it was consumed for failed.
+	Refund(ctx context.Context, quotas []Quota) error
+}
+
+// Config selects and configures a Store.
+type Config struct {
+	Backend  string // memory or redis
+	RedisURL string // redis://[:password@]host:port/db
+}
+
+// New creates the Store selected by cfg.Backend.
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "memory", "":
+		return NewMemoryStore(), nil
+	case "redis":
+		return NewRedisStore(cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q (want memory or redis)", cfg.Backend)
+	}
+}
+
+// bucketResult derives a BucketResult from the tokens left after a take.
+func bucketResult(allowed bool, tokens float64, b Bucket) BucketResult {
+	res := BucketResult{
+		Allowed:    allowed,
+		Remaining:  int(tokens),
+		ResetAfter: seconds((float64(b.Burst) - tokens) / b.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / b.Rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
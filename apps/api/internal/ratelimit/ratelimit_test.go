@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testStore is a Store whose clock the test controls.
+type testStore struct {
+	Store
+	setNow func(time.Time)
+}
+
+// stores returns a MemoryStore and a RedisStore backed by an in-process Redis,
+// both starting at t0.
+func stores(t *testing.T, t0 time.Time) map[string]testStore {
+	mem := NewMemoryStore()
+	mem.now = func() time.Time { return t0 }
+
+	mr := miniredis.RunT(t)
+	mr.SetTime(t0)
+	rs, err := NewRedisStore("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rs.Close() })
+
+	return map[string]testStore{
+		"memory": {mem, func(now time.Time) { mem.now = func() time.Time { return now } }},
+		"redis":  {rs, mr.SetTime},
+	}
+}
+
+// near reports whether d is within a millisecond of want (the Redis store keeps
+// tokens as decimal strings).
+func near(d, want time.Duration) bool {
+	return d > want-time.Millisecond && d < want+time.Millisecond
+}
+
+func TestTake(t *testing.T) {
+	t0 := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	bucket := Bucket{Rate: 1, Burst: 3}
+
+	steps := []struct {
+		at         time.Duration // Since t0
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		resetAfter time.Duration
+	}{
+		// The burst is available at once
+		{0, true, 2, 0, 1 * time.Second},
+		{0, true, 1, 0, 2 * time.Second},
+		{0, true, 0, 0, 3 * time.Second},
+		{0, false, 0, time.Second, 3 * time.Second},
+		// Refills at Rate: 1.5 tokens after 1.5s
+		{1500 * time.Millisecond, true, 0, 0, 2500 * time.Millisecond},
+		{1500 * time.Millisecond, false, 0, 500 * time.Millisecond, 2500 * time.Millisecond},
+		// Never beyond Burst
+		{time.Hour, true, 2, 0, time.Second},
+	}
+	for name, store := range stores(t, t0) {
+		for i, step := range steps {
+			store.setNow(t0.Add(step.at))
+			res, err := store.Take(context.Background(), "bucket", bucket)
+			if err != nil {
+				t.Fatalf("%s step %d: %v", name, i, err)
+			}
+			if res.Allowed != step.allowed || res.Remaining != step.remaining ||
+				!near(res.RetryAfter, step.retryAfter) || !near(res.ResetAfter, step.resetAfter) {
+				t.Errorf("%s step %d: Take = %+v, want allowed %v, remaining %d, retry after %v, reset after %v",
+					name, i, res, step.allowed, step.remaining, step.retryAfter, step.resetAfter)
+			}
+		}
+
+		// Buckets are independent
+		res, err := store.Take(context.Background(), "other", bucket)
+		if err != nil || !res.Allowed || res.Remaining != 2 {
+			t.Errorf("%s: Take(other) = %+v, %v, want a full bucket", name, res, err)
+		}
+	}
+}
+
+func TestConsume(t *testing.T) {
+	t0 := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	month := Quota{Key: "month:2024-03", Limit: 3, Reset: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}
+	day30 := Quota{Key: "day:2024-03-30", Limit: 2, Reset: time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)}
+	day31 := Quota{Key: "day:2024-03-31", Limit: 2, Reset: month.Reset}
+
+	steps := []struct {
+		name     string
+		consume  []Quota
+		refund   []Quota
+		allowed  bool
+		exceeded int
+		counts   []int64
+	}{
+		{"first", []Quota{day30, month}, nil, true, 0, []int64{1, 1}},
+		{"second", []Quota{day30, month}, nil, true, 0, []int64{2, 2}},
+		{"daily quota exhausted", []Quota{day30, month}, nil, false, 0, nil},
+		// Next day: a new daily counter, the monthly one carries on (unchanged by the refusal)
+		{"next day", []Quota{day31, month}, nil, true, 0, []int64{1, 3}},
+		{"monthly quota exhausted", []Quota{day31, month}, nil, false, 1, nil},
+		{"after a refund", []Quota{day31, month}, []Quota{day31, month}, true, 0, []int64{1, 3}},
+		// Refunds never go below zero
+		{"refund of an unused counter", []Quota{{Key: "day:2024-04-01", Limit: 1, Reset: t0.Add(time.Hour)}},
+			[]Quota{{Key: "day:2024-04-01"}}, true, 0, []int64{1}},
+	}
+	for name, store := range stores(t, t0) {
+		for _, step := range steps {
+			if step.refund != nil {
+				if err := store.Refund(context.Background(), step.refund); err != nil {
+					t.Fatalf("%s %s: Refund: %v", name, step.name, err)
+				}
+			}
+			res, err := store.Consume(context.Background(), step.consume)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, step.name, err)
+			}
+			if res.Allowed != step.allowed || (!res.Allowed && res.Exceeded != step.exceeded) || !slices.Equal(res.Counts, step.counts) {
+				t.Errorf("%s %s: Consume = %+v, want allowed %v, exceeded %d, counts %v",
+					name, step.name, res, step.allowed, step.exceeded, step.counts)
+			}
+		}
+	}
+}
+
+func TestRedisQuotaExpiry(t *testing.T) {
+	t0 := time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC)
+	mr := miniredis.RunT(t)
+	mr.SetTime(t0)
+	rs, err := NewRedisStore("redis://" + mr.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Close()
+
+	q := Quota{Key: "day:2024-03-31", Limit: 5, Reset: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := rs.Consume(context.Background(), []Quota{q}); err != nil {
+		t.Fatal(err)
+	}
+	// Kept a day past the window, so late refunds still find it
+	if ttl := mr.TTL(q.Key); ttl != 25*time.Hour {
+		t.Fatalf("TTL = %v, want 25h", ttl)
+	}
+	if _, err := rs.Take(context.Background(), "bucket", Bucket{Rate: 1, Burst: 3}); err != nil {
+		t.Fatal(err)
+	}
+	// Kept until it would be full again, plus a second
+	if ttl := mr.TTL("bucket"); ttl != 2*time.Second {
+		t.Fatalf("bucket TTL = %v, want 2s", ttl)
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from a token bucket stored as a hash {tokens, ts}.
+// The clock is Redis' own, so replicas with skewed clocks share one timeline.
+// KEYS[1]: bucket; ARGV: rate (tokens/s), burst. Returns {allowed, tokens}.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// consumeScript increments all counters unless one is at its limit.
+// KEYS: counters; ARGV: limit and expiry (unix seconds) per key.
+// Returns {1, count...} or {0, index of the exhausted counter (1-based)}.
+var consumeScript = redis.NewScript(`
+for i, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') >= tonumber(ARGV[2 * i - 1]) then
+		return {0, i}
+	end
+end
+local res = {1}
+for i, key in ipairs(KEYS) do
+	local n = redis.call('INCR', key)
+	if n == 1 then
+		redis.call('EXPIREAT', key, ARGV[2 * i])
+	end
+	res[i + 1] = n
+end
+return res
+`)
+
+// refundScript decrements counters that are above zero.
+var refundScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
+
+// RedisStore keeps rate limit state in Redis (or a compatible server such as
+// Valkey or KeyDB), so the limits hold across all API replicas.
+// Keys of one user must share a Redis Cluster hash slot; see the {userID} tags
+// built by the rate limit middleware.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the server at url (redis://[:password@]host:port/db).
+func NewRedisStore(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	return &RedisStore{client: redis.NewClient(opts)}, nil
+}
+
+// Ping checks that the server is reachable.
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the connection pool.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// Take takes one token from the bucket named key.
+func (s *RedisStore) Take(ctx context.Context, key string, b Bucket) (BucketResult, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{key}, b.Rate, b.Burst).Slice()
+	if err != nil {
+		return BucketResult{}, err
+	}
+	if len(res) != 2 {
+		return BucketResult{}, fmt.Errorf("unexpected bucket reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return BucketResult{}, fmt.Errorf("unexpected bucket tokens %q", tokensStr)
+	}
+	return bucketResult(allowed == 1, tokens, b), nil
+}
+
+// Consume increments every quota by one, unless any of them is exhausted.
+func (s *RedisStore) Consume(ctx context.Context, quotas []Quota) (QuotaResult, error) {
+	keys := make([]string, len(quotas))
+	args := make([]interface{}, 0, 2*len(quotas))
+	for i, q := range quotas {
+		keys[i] = q.Key
+		// Kept a day past the window so a late refund still finds the counter
+		args = append(args, q.Limit, q.Reset.Add(24*time.Hour).Unix())
+	}
+
+	res, err := consumeScript.Run(ctx, s.client, keys, args...).Int64Slice()
+	if err != nil {
+		return QuotaResult{}, err
+	}
+	if len(res) < 2 {
+		return QuotaResult{}, fmt.Errorf("unexpected quota reply %v", res)
+	}
+	if res[0] == 0 {
+		return QuotaResult{Exceeded: int(res[1] - 1)}, nil
+	}
+	return QuotaResult{Allowed: true, Counts: res[1:]}, nil
+}
+
+// Refund decrements every quota by one.
+func (s *RedisStore) Refund(ctx context.Context, quotas []Quota) error {
+	keys := make([]string, len(quotas))
+	for i, q := range quotas {
+		keys[i] = q.Key
+	}
+	return refundScript.Run(ctx, s.client, keys).Err()
+}
@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/api/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// subscriberBuffer is how many updates a subscriber may fall behind before it is dropped
+	subscriberBuffer = 32
+
+	// retryDelay is the pause before re-opening a failed change stream
+	retryDelay = time.Second
+)
+
+// Hub watches the tasks collection with a single MongoDB change stream and fans
+// task status changes out to the subscribers of each user.
+//
+// Slow subscribers are not allowed to hold up the others: once a subscriber's
+// buffer is full its channel is closed, and the client is expected to reconnect
+// and reload its tasks.
+type Hub struct {
+	tasks *mongo.Collection
+
+	mu     sync.Mutex
+	subs   map[string]map[chan models.Task]struct{} // user ID -> subscriber channels
+	closed bool
+}
+
+// NewHub creates a hub for the tasks collection. Call Run to start watching.
+func NewHub(db *mongo.Database) *Hub {
+	return &Hub{
+		tasks: db.Collection("tasks"),
+		subs:  make(map[string]map[chan models.Task]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the user's tasks whenever they are created
+// or change status, and a function that cancels the subscription.
+// The channel is closed when the subscriber falls behind or the hub stops.
+func (h *Hub) Subscribe(userID string) (<-chan models.Task, func()) {
+	ch := make(chan models.Task, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan models.Task]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	metrics.StreamSubscribers.Inc()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.remove(userID, ch)
+	}
+}
+
+// Run watches the change stream until ctx is cancelled, then closes all subscriptions.
+// If the stream fails it is re-opened from the last seen resume token, so no
+// change is missed across transient errors (e.g., a replica set election).
+func (h *Hub) Run(ctx context.Context) {
+	slog.Info("Task stream hub started")
+	defer h.closeAll()
+
+	var resumeToken bson.Raw
+	for {
+		err := h.watch(ctx, &resumeToken)
+		if ctx.Err() != nil {
+			slog.Info("Task stream hub stopped")
+			return
+		}
+		slog.Warn("Task change stream failed, reopening", "error", err)
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			slog.Info("Task stream hub stopped")
+			return
+		}
+	}
+}
+
+// watch opens the change stream and publishes changes until it fails.
+// resumeToken is updated after every change and used to resume on the next call.
+func (h *Hub) watch(ctx context.Context, resumeToken *bson.Raw) error {
+	// Only inserts and updates that touch the status are interesting
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"$or": bson.A{
+				bson.M{"operationType": "insert"},
+				bson.M{"updateDescription.updatedFields.status": bson.M{"$exists": true}},
+			},
+		}}},
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if *resumeToken != nil {
+		opts.SetResumeAfter(*resumeToken)
+	}
+
+	cs, err := h.tasks.Watch(ctx, pipeline, opts)
+	if err != nil {
+		// The token may have fallen off the oplog; start fresh next time
+		*resumeToken = nil
+		return err
+	}
+	defer cs.Close(context.Background())
+
+	for cs.Next(ctx) {
+		*resumeToken = cs.ResumeToken()
+
+		var change struct {
+			FullDocument *models.Task `bson:"fullDocument"`
+		}
+		if err := cs.Decode(&change); err != nil {
+			slog.Warn("Failed to decode task change", "error", err)
+			continue
+		}
+		// Nil if the task was deleted before the lookup
+		if change.FullDocument != nil {
+			h.publish(*change.FullDocument)
+		}
+	}
+	return cs.Err()
+}
+
+// publish delivers task to its owner's subscribers without blocking.
+func (h *Hub) publish(task models.Task) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[task.UserID] {
+		select {
+		case ch <- task:
+		default:
+			slog.Warn("Dropping slow task stream subscriber", "user_id", task.UserID)
+			h.remove(task.UserID, ch)
+		}
+	}
+}
+
+// remove closes and forgets a subscriber. h.mu must be held.
+func (h *Hub) remove(userID string, ch chan models.Task) {
+	if _, ok := h.subs[userID][ch]; !ok {
+		return // Already removed
+	}
+	delete(h.subs[userID], ch)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+	close(ch)
+	metrics.StreamSubscribers.Dec()
+}
+
+// closeAll ends every subscription and rejects new ones.
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for userID, subs := range h.subs {
+		for ch := range subs {
+			h.remove(userID, ch)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/api/internal/metrics"
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/sanjain/pixelflow/pkg/safehttp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// leaseDuration is how long a dispatcher owns a delivery before another may retry it
+	leaseDuration = time.Minute
+
+	// requestTimeout bounds a single delivery attempt
+	requestTimeout = 10 * time.Second
+
+	// maxBackoff caps the delay between attempts
+	maxBackoff = time.Hour
+)
+
+// Payload is the JSON body POSTed to webhooks.
+type Payload struct {
+	ID        string                    `json:"id"` // Same as the X-PixelFlow-Delivery header's event ID
+	Event     string                    `json:"event"`
+	CreatedAt time.Time                 `json:"created_at"`
+	Data      events.TaskLifecycleEvent `json:"data"`
+}
+
+// Dispatcher turns task lifecycle events into deliveries and sends them.
+//
+// Enqueue stores one delivery per subscribed webhook; Run polls for due deliveries,
+// POSTs them and records every attempt. Failed attempts (network errors and non-2xx
+// responses) are retried with exponential backoff until maxAttempts is reached.
+// Delivery is at-least-once, so receivers should deduplicate on the payload ID.
+type Dispatcher struct {
+	webhooks    *mongo.Collection
+	deliveries  *mongo.Collection
+	httpClient  *http.Client
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	notify      chan struct{}
+}
+
+// NewDispatcher creates a dispatcher that polls for due deliveries every interval.
+// maxAttempts: Attempts per delivery before it is marked FAILED
+// backoff: Delay after the first failed attempt; doubled after each further failure
+// allowPrivate: Deliver to loopback and private addresses too (local development only)
+func NewDispatcher(db *mongo.Database, interval time.Duration, maxAttempts int, backoff time.Duration, allowPrivate bool) *Dispatcher {
+	// Connections to internal addresses are refused at dial time, after DNS resolution,
+	// so a receiver cannot reach MongoDB, Redis, MinIO or the cloud metadata endpoint
+	httpClient := safehttp.NewClient(safehttp.Config{Timeout: requestTimeout, AllowPrivate: allowPrivate})
+	// Receivers must answer directly; a redirect's status is recorded instead of followed
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Dispatcher{
+		webhooks:    db.Collection(WebhooksCollection),
+		deliveries:  db.Collection(DeliveriesCollection),
+		httpClient:  httpClient,
+		interval:    interval,
+		maxAttempts: max(1, maxAttempts),
+		backoff:     backoff,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+// Enqueue creates a delivery for every webhook of the event's user that subscribes
+// to it. It is idempotent: enqueueing the same event twice creates no duplicates.
+// Events other than COMPLETED and FAILED are ignored.
+func (d *Dispatcher) Enqueue(ctx context.Context, event events.TaskLifecycleEvent) error {
+	var eventType string
+	switch event.Status {
+	case events.StatusCompleted:
+		eventType = EventTaskCompleted
+	case events.StatusFailed:
+		eventType = EventTaskFailed
+	default:
+		return nil
+	}
+
+	cursor, err := d.webhooks.Find(ctx, bson.M{"user_id": event.UserID, "events": eventType})
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	var hooks []Webhook
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	// Task ID + event + time identify the event: a redelivered Kafka message keeps its
+	// occurred_at, while a task that was requeued by an admin reports a new one
+	eventID := fmt.Sprintf("%s:%s:%d", event.TaskID, eventType, event.OccurredAt.UnixMilli())
+	body, err := json.Marshal(Payload{
+		ID:        eventID,
+		Event:     eventType,
+		CreatedAt: event.OccurredAt,
+		Data:      event,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	now := time.Now()
+	for _, hook := range hooks {
+		delivery := Delivery{
+			ID:            primitive.NewObjectID(),
+			WebhookID:     hook.ID,
+			UserID:        hook.UserID,
+			EventID:       eventID,
+			Event:         eventType,
+			Payload:       string(body),
+			Status:        DeliveryPending,
+			Attempts:      []Attempt{},
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if _, err := d.deliveries.InsertOne(ctx, delivery); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				continue // Already enqueued by an earlier copy of the event
+			}
+			return fmt.Errorf("failed to store delivery: %w", err)
+		}
+		slog.Info("Webhook delivery enqueued", "webhook_id", hook.ID.Hex(), "event_id", eventID)
+	}
+
+	d.Notify()
+	return nil
+}
+
+// Notify wakes the dispatcher up without waiting for the next poll.
+// It never blocks; extra notifications are coalesced.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	slog.Info("Webhook dispatcher started", "interval", d.interval.String())
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		case <-d.notify:
+		}
+	}
+}
+
+// drain sends deliveries until none are due.
+func (d *Dispatcher) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		delivery, err := d.claim(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			slog.Error("Webhooks: Failed to claim delivery", "error", err)
+			return
+		}
+		d.deliver(ctx, delivery)
+	}
+}
+
+// claim atomically leases the oldest due pending delivery whose lease is free.
+func (d *Dispatcher) claim(ctx context.Context) (Delivery, error) {
+	now := time.Now()
+	filter := bson.M{
+		"status":          DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(leaseDuration)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery Delivery
+	err := d.deliveries.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	return delivery, err
+}
+
+// deliver makes one attempt and records its outcome, scheduling a retry on failure.
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) {
+	var hook Webhook
+	err := d.webhooks.FindOne(ctx, bson.M{"_id": delivery.WebhookID}).Decode(&hook)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The webhook was deleted after the delivery was enqueued
+		d.finish(ctx, delivery, DeliveryFailed, Attempt{At: time.Now(), Error: "webhook deleted"}, time.Time{})
+		return
+	}
+	if err != nil {
+		slog.Error("Webhooks: Failed to load webhook", "webhook_id", delivery.WebhookID.Hex(), "error", err)
+		return // The lease expires and the delivery is retried
+	}
+
+	attempt := d.send(ctx, hook, delivery)
+	attemptNo := len(delivery.Attempts) + 1
+
+	switch {
+	case attempt.Error == "":
+		metrics.WebhookDeliveriesTotal.WithLabelValues("success").Inc()
+		slog.Info("Webhook delivered", "delivery_id", delivery.ID.Hex(), "status_code", attempt.StatusCode, "attempt", attemptNo)
+		d.finish(ctx, delivery, DeliverySucceeded, attempt, time.Time{})
+	case attemptNo >= d.maxAttempts:
+		metrics.WebhookDeliveriesTotal.WithLabelValues("failure").Inc()
+		slog.Warn("Webhook delivery failed permanently", "delivery_id", delivery.ID.Hex(), "attempts", attemptNo, "error", attempt.Error)
+		d.finish(ctx, delivery, DeliveryFailed, attempt, time.Time{})
+	default:
+		metrics.WebhookDeliveriesTotal.WithLabelValues("retry").Inc()
+		next := time.Now().Add(d.backoffFor(attemptNo))
+		slog.Warn("Webhook delivery failed, will retry", "delivery_id", delivery.ID.Hex(), "attempt", attemptNo, "next_attempt_at", next, "error", attempt.Error)
+		d.finish(ctx, delivery, DeliveryPending, attempt, next)
+	}
+}
+
+// send POSTs the signed payload and describes the result. Any non-2xx response is a failure.
+func (d *Dispatcher) send(ctx context.Context, hook Webhook, delivery Delivery) Attempt {
+	start := time.Now()
+	attempt := Attempt{At: start}
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PixelFlow-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.EventID)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, start, body))
+
+	resp, err := d.httpClient.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Allow connection reuse
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// finish appends attempt to the delivery log, sets the new status and releases the lease.
+// next is the time of the next attempt for deliveries that stay PENDING.
+func (d *Dispatcher) finish(ctx context.Context, delivery Delivery, status string, attempt Attempt, next time.Time) {
+	set := bson.M{
+		"status":     status,
+		"updated_at": time.Now(),
+	}
+	if !next.IsZero() {
+		set["next_attempt_at"] = next
+	}
+	update := bson.M{
+		"$set":   set,
+		"$push":  bson.M{"attempts": attempt},
+		"$unset": bson.M{"locked_until": ""},
+	}
+	if _, err := d.deliveries.UpdateByID(ctx, delivery.ID, update); err != nil {
+		// The lease will expire and the delivery will be attempted again (at-least-once)
+		slog.Error("Webhooks: Failed to record attempt", "delivery_id", delivery.ID.Hex(), "error", err)
+	}
+}
+
+// backoffFor returns the delay after the given failed attempt (1-based).
+func (d *Dispatcher) backoffFor(attempt int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
@@ -0,0 +1,116 @@
+// Package webhooks stores user webhook registrations and delivers signed
+// task notifications to them.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/sanjain/pixelflow/pkg/safehttp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MongoDB collections
+const (
+	WebhooksCollection   = "webhooks"
+	DeliveriesCollection = "webhook_deliveries"
+)
+
+// Event types a webhook can subscribe to
+const (
+	EventTaskCompleted = "task.completed"
+	EventTaskFailed    = "task.failed"
+)
+
+// AllEvents is the subscription used when a webhook does not list any events.
+var AllEvents = []string{EventTaskCompleted, EventTaskFailed}
+
+// Request headers sent with every delivery
+const (
+	HeaderEvent     = "X-PixelFlow-Event"
+	HeaderDelivery  = "X-PixelFlow-Delivery"
+	HeaderSignature = "X-PixelFlow-Signature"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "PENDING"
+	DeliverySucceeded = "SUCCEEDED"
+	DeliveryFailed    = "FAILED" // Gave up after the last attempt
+)
+
+// Webhook is a URL a user registered to be notified about their tasks.
+type Webhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	URL       string             `bson:"url" json:"url"`
+	Secret    string             `bson:"secret" json:"-"` // HMAC key; only returned when the webhook is created
+	Events    []string           `bson:"events" json:"events"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Attempt records one HTTP request made for a delivery.
+type Attempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMs int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Delivery is one event to be sent to one webhook, with its attempt history.
+type Delivery struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WebhookID     primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	UserID        string             `bson:"user_id" json:"user_id"`
+	EventID       string             `bson:"event_id" json:"event_id"` // Unique per event; deduplicates redelivered Kafka messages
+	Event         string             `bson:"event" json:"event"`
+	Payload       string             `bson:"payload" json:"payload"` // Request body, exactly as signed
+	Status        string             `bson:"status" json:"status"`
+	Attempts      []Attempt          `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   *time.Time         `bson:"locked_until,omitempty" json:"-"` // Lease held by the dispatcher sending it
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// ValidateURL checks that a webhook URL is an absolute http(s) URL whose host is
+// not a private or loopback IP address (unless allowPrivate). Hostnames are checked
+// again by the dispatcher each time it connects, since DNS can change after registration.
+func ValidateURL(raw string, allowPrivate bool) error {
+	return safehttp.CheckURL(raw, allowPrivate)
+}
+
+// ValidateEvents checks that every event type is known.
+func ValidateEvents(events []string) error {
+	for _, e := range events {
+		if e != EventTaskCompleted && e != EventTaskFailed {
+			return errors.New("unknown event " + strconv.Quote(e))
+		}
+	}
+	return nil
+}
+
+// NewSecret generates a random signing secret.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-PixelFlow-Signature header value for body sent at time t:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+// Receivers should recompute the HMAC and reject old timestamps to prevent replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
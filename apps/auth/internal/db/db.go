@@ -12,6 +12,9 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// Models are the tables migrated at startup.
+var Models = []any{&models.User{}, &models.Role{}, &models.Permission{}, &models.Session{}, &models.RefreshToken{}, &models.APIKey{}, &models.EmailToken{}, &models.LoginThrottle{}, &models.RecoveryCode{}, &models.MFAChallenge{}}
+
 type Handler struct {
 	DB *gorm.DB
 }
@@ -35,10 +38,28 @@ func Init(url string) *Handler {
 		log.Fatalln(err)
 	}
 
-	// Auto Migrate the User model
-	db.AutoMigrate(&models.User{})
+	// Accounts created before email verification existed are treated as verified
+	grandfather := !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	// Auto Migrate the models
+	db.AutoMigrate(Models...)
+
+	if grandfather {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatalln(err)
+		}
+	}
 
 	slog.Info("Database connected and migrated")
 
 	return &Handler{DB: db}
 }
+
+// Close closes the underlying Postgres connection pool.
+func (h *Handler) Close() error {
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
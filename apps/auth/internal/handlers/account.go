@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/auth/internal/mailer"
+	"github.com/sanjain/pixelflow/apps/auth/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// emailResendInterval is the minimum time between two emails of the same kind to one user
+const emailResendInterval = time.Minute
+
+// sendTimeout bounds a single email delivery
+const sendTimeout = 10 * time.Second
+
+// errInvalidEmailToken covers unknown, used, superseded and expired email tokens
+var errInvalidEmailToken = errors.New("invalid or expired token")
+
+// VerifyEmail handles POST /verify-email
+// Body: {"token": "..."} from the link in the verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var userID uint
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeEmailToken(tx, req.Token, models.PurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		c.JSON(400, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+	if err != nil {
+		slog.Error("VerifyEmail: Failed to verify email", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	slog.Info("Email verified", "user_id", userID)
+	c.JSON(200, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification handles POST /verify-email/resend
+// Body: {"email": "..."}. Always answers 202 so it cannot be used to probe for accounts.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	h.requestEmail(c.Request.Context(), req.Email, models.PurposeVerifyEmail)
+
+	c.JSON(202, gin.H{"message": "If the account exists and is unverified, a verification email has been sent"})
+}
+
+// ForgotPassword handles POST /password/forgot
+// Body: {"email": "..."}. Always answers 202 so it cannot be used to probe for accounts.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	h.requestEmail(c.Request.Context(), req.Email, models.PurposePasswordReset)
+
+	c.JSON(202, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// ResetPassword handles POST /password/reset
+// Body: {"token": "...", "password": "..."}
+// Sets the new password and revokes all of the user's sessions. The reset link proves
+// ownership of the address, so the email is marked verified as well.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	hashedPw, err := utils.HashPassword(req.Password)
+	if err != nil {
+		slog.Error("ResetPassword: Failed to hash password", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var userID uint
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeEmailToken(tx, req.Token, models.PurposePasswordReset)
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+
+		// 1. New password
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("password", hashedPw).Error; err != nil {
+			return err
+		}
+		// 2. Mark the email verified
+		err = tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userID).
+			Update("email_verified_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		// 3. Log out everywhere, in case the old password leaked
+		return revokeUserSessions(tx, userID)
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		c.JSON(400, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+	if err != nil {
+		slog.Error("ResetPassword: Failed to reset password", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	slog.Info("Password reset", "user_id", userID)
+	c.JSON(200, gin.H{"message": "Password has been reset; please log in"})
+}
+
+// requestEmail starts the email flow for the account of email, if there is one, in the
+// background. The lookup, the token and the (slow) delivery all happen after the
+// response, so it takes the same time whether or not the account exists.
+// Verification emails only go to accounts that are not verified yet.
+func (h *AuthHandler) requestEmail(ctx context.Context, email, purpose string) {
+	ctx = context.WithoutCancel(ctx)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		query := h.db.WithContext(ctx).Where("email = ?", email)
+		if purpose == models.PurposeVerifyEmail {
+			query = query.Where("email_verified_at IS NULL")
+		}
+		var user models.User
+		err := query.First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to look up account for email", "purpose", purpose, "error", err)
+			return
+		}
+		h.startEmailFlow(ctx, user, purpose)
+	}()
+}
+
+// Wait blocks until emails started in the background have been sent, or ctx is done.
+// Call it on shutdown after the HTTP server has drained.
+func (h *AuthHandler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startEmailFlow issues a token for purpose and emails its link to the user.
+// Failures are logged only: callers answer the same way whether or not an email went out.
+func (h *AuthHandler) startEmailFlow(ctx context.Context, user models.User, purpose string) {
+	var token string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, err = issueEmailToken(tx, user.ID, purpose, h.emailTokenTTL(purpose))
+		return err
+	})
+	if err != nil {
+		slog.Error("Failed to issue email token", "user_id", user.ID, "purpose", purpose, "error", err)
+		return
+	}
+	if token == "" {
+		slog.Info("Email recently sent, not sending another", "user_id", user.ID, "purpose", purpose)
+		return
+	}
+	h.sendEmail(ctx, user.Email, purpose, token)
+}
+
+// emailTokenTTL returns the configured lifetime of a token for purpose.
+func (h *AuthHandler) emailTokenTTL(purpose string) time.Duration {
+	if purpose == models.PurposePasswordReset {
+		return h.cfg.PasswordResetTTL
+	}
+	return h.cfg.VerificationTTL
+}
+
+// sendEmail emails the link for token and records the outcome.
+func (h *AuthHandler) sendEmail(ctx context.Context, to, purpose, token string) {
+	var msg mailer.Message
+	ttl := h.emailTokenTTL(purpose)
+	switch purpose {
+	case models.PurposeVerifyEmail:
+		msg = mailer.Message{
+			To:      to,
+			Subject: "Verify your PixelFlow email address",
+			Body: fmt.Sprintf("Welcome to PixelFlow!\n\nConfirm your email address by opening this link:\n\n%s\n\n"+
+				"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+				h.appLink("/verify-email", token), ttl),
+		}
+	case models.PurposePasswordReset:
+		msg = mailer.Message{
+			To:      to,
+			Subject: "Reset your PixelFlow password",
+			Body: fmt.Sprintf("Someone asked to reset the password of your PixelFlow account.\n\n"+
+				"Choose a new password by opening this link:\n\n%s\n\n"+
+				"The link expires in %s. If you did not ask for this, you can ignore this email.\n",
+				h.appLink("/reset-password", token), ttl),
+		}
+	}
+
+	// Detached from the request so a client disconnect does not abort the send
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+	defer cancel()
+	if err := h.mailer.Send(ctx, msg); err != nil {
+		metrics.EmailsSentTotal.WithLabelValues(purpose, "failure").Inc()
+		slog.Error("Failed to send email", "purpose", purpose, "error", err)
+		return
+	}
+	metrics.EmailsSentTotal.WithLabelValues(purpose, "success").Inc()
+}
+
+// appLink builds a frontend link carrying token.
+func (h *AuthHandler) appLink(path, token string) string {
+	return h.cfg.AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// issueEmailToken creates a token for purpose, superseding the user's older unused ones.
+// It returns an empty token if one was issued within emailResendInterval.
+func issueEmailToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	var recent int64
+	err := tx.Model(&models.EmailToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, purpose, now.Add(-emailResendInterval)).
+		Count(&recent).Error
+	if err != nil || recent > 0 {
+		return "", err
+	}
+
+	// Only the latest link works
+	err = tx.Model(&models.EmailToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = tx.Create(&models.EmailToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: now.Add(ttl),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeEmailToken marks an unused, unexpired token for purpose as used and returns it.
+func consumeEmailToken(tx *gorm.DB, token, purpose string) (models.EmailToken, error) {
+	// Lock the token row so concurrent uses of the same link serialize
+	var et models.EmailToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).
+		First(&et).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return et, errInvalidEmailToken
+	}
+	if err != nil {
+		return et, err
+	}
+
+	now := time.Now()
+	if et.UsedAt != nil || now.After(et.ExpiresAt) {
+		return et, errInvalidEmailToken
+	}
+	if err := tx.Model(&et).Update("used_at", now).Error; err != nil {
+		return et, err
+	}
+	return et, nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+)
+
+func TestConsumeEmailToken(t *testing.T) {
+	_, db, user := newTestHandler(t)
+	token, err := issueEmailToken(db, user.ID, models.PurposePasswordReset, time.Hour)
+	if err != nil || token == "" {
+		t.Fatalf("issueEmailToken = %q, %v", token, err)
+	}
+
+	// A token only works for its own purpose
+	if _, err := consumeEmailToken(db, token, models.PurposeVerifyEmail); !errors.Is(err, errInvalidEmailToken) {
+		t.Fatalf("consume for another purpose: error = %v, want errInvalidEmailToken", err)
+	}
+
+	et, err := consumeEmailToken(db, token, models.PurposePasswordReset)
+	if err != nil || et.UserID != user.ID {
+		t.Fatalf("first use = %+v, %v, want the token of user %d", et, err, user.ID)
+	}
+	if _, err := consumeEmailToken(db, token, models.PurposePasswordReset); !errors.Is(err, errInvalidEmailToken) {
+		t.Fatalf("second use: error = %v, want errInvalidEmailToken", err)
+	}
+	if _, err := consumeEmailToken(db, "unknown", models.PurposePasswordReset); !errors.Is(err, errInvalidEmailToken) {
+		t.Fatalf("unknown token: error = %v, want errInvalidEmailToken", err)
+	}
+}
+
+func TestConsumeEmailTokenExpired(t *testing.T) {
+	_, db, user := newTestHandler(t)
+	token, err := issueEmailToken(db, user.ID, models.PurposeVerifyEmail, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(&models.EmailToken{}).Where("token_hash = ?", utils.HashToken(token)).
+		Update("expires_at", time.Now().Add(-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumeEmailToken(db, token, models.PurposeVerifyEmail); !errors.Is(err, errInvalidEmailToken) {
+		t.Fatalf("expired token: error = %v, want errInvalidEmailToken", err)
+	}
+}
+
+func TestIssueEmailTokenSupersedesOlder(t *testing.T) {
+	_, db, user := newTestHandler(t)
+	older, err := issueEmailToken(db, user.ID, models.PurposeVerifyEmail, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the resend interval no new token is issued
+	if token, err := issueEmailToken(db, user.ID, models.PurposeVerifyEmail, time.Hour); err != nil || token != "" {
+		t.Fatalf("immediate resend = %q, %v, want no token", token, err)
+	}
+
+	err = db.Model(&models.EmailToken{}).Where("user_id = ?", user.ID).
+		Update("created_at", time.Now().Add(-emailResendInterval-time.Second)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer, err := issueEmailToken(db, user.ID, models.PurposeVerifyEmail, time.Hour)
+	if err != nil || newer == "" {
+		t.Fatalf("resend = %q, %v", newer, err)
+	}
+	if _, err := consumeEmailToken(db, older, models.PurposeVerifyEmail); !errors.Is(err, errInvalidEmailToken) {
+		t.Fatalf("superseded token: error = %v, want errInvalidEmailToken", err)
+	}
+	if _, err := consumeEmailToken(db, newer, models.PurposeVerifyEmail); err != nil {
+		t.Fatalf("newest token: %v", err)
+	}
+}
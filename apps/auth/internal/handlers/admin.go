@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/auth/internal/lockout"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/rbac"
+	"gorm.io/gorm"
+)
+
+// Page size limits for ListUsers
+const (
+	DefaultUserPageSize = 50
+	MaxUserPageSize     = 200
+)
+
+// AdminHandler serves the user management endpoints under /admin.
+// Routes must be protected with RequireScope(models.ScopeAdminUsers).
+type AdminHandler struct {
+	db      *gorm.DB
+	limiter *lockout.Limiter
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(db *gorm.DB, limiter *lockout.Limiter) *AdminHandler {
+	return &AdminHandler{db: db, limiter: limiter}
+}
+
+// adminUser is the admin view of a user; the password hash is never returned.
+type adminUser struct {
+	ID          uint       `json:"id"`
+	Email       string     `json:"email"`
+	Roles       []string   `json:"roles"`
+	MFAEnabled  bool       `json:"mfa_enabled"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"` // Only set by GetUser
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func toAdminUser(u models.User) adminUser {
+	roles := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		roles = append(roles, r.Name)
+	}
+	slices.Sort(roles)
+	return adminUser{ID: u.ID, Email: u.Email, Roles: roles, MFAEnabled: u.TOTPEnabledAt != nil, CreatedAt: u.CreatedAt}
+}
+
+// ListUsers handles GET /admin/users
+// Query parameters: limit, offset, email (exact match), role
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultUserPageSize)))
+	if err != nil || limit < 1 || limit > MaxUserPageSize {
+		c.JSON(400, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(MaxUserPageSize)})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(400, gin.H{"error": "offset must not be negative"})
+		return
+	}
+
+	query := h.db.Model(&models.User{})
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", email)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("id IN (?)", h.db.Table("user_roles").
+			Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.name = ?", role))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		slog.Error("ListUsers: Failed to count users", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	var users []models.User
+	if err := query.Preload("Roles").Order("id").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		slog.Error("ListUsers: Failed to list users", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to list users"})
+		return
+	}
+
+	out := make([]adminUser, 0, len(users))
+	for _, u := range users {
+		out = append(out, toAdminUser(u))
+	}
+	c.JSON(200, gin.H{"users": out, "total": total})
+}
+
+// GetUser handles GET /admin/users/:id
+// Includes locked_until while the account is locked out after failed logins
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	out := toAdminUser(user)
+	lockedUntil, err := h.limiter.LockedUntil(user.Email)
+	if err != nil {
+		slog.Error("GetUser: Failed to load lockout", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to load user"})
+		return
+	}
+	out.LockedUntil = lockedUntil
+	c.JSON(200, out)
+}
+
+// SetRoles handles PUT /admin/users/:id/roles
+// Replaces the user's roles. The new scopes are in the user's tokens after their next refresh.
+func (h *AdminHandler) SetRoles(c *gin.Context) {
+	var req struct {
+		Roles []string `json:"roles" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	// Admins cannot demote themselves, so there is always someone left to undo mistakes
+	if h.isSelf(c, user) && !slices.Contains(req.Roles, models.RoleAdmin) {
+		c.JSON(409, gin.H{"error": "Cannot remove your own admin role"})
+		return
+	}
+
+	err := rbac.SetRoles(h.db, &user, req.Roles)
+	if errors.Is(err, rbac.ErrUnknownRole) {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("SetRoles: Failed to update roles", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to update roles"})
+		return
+	}
+
+	slog.Info("User roles updated", "user_id", user.ID, "roles", req.Roles, "by", c.GetString("userID"))
+	c.JSON(200, toAdminUser(user))
+}
+
+// RevokeSessions handles DELETE /admin/users/:id/sessions
+// Logs the user out everywhere
+func (h *AdminHandler) RevokeSessions(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	if err := revokeUserSessions(h.db, user.ID); err != nil {
+		slog.Error("RevokeSessions: Failed to revoke sessions", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	slog.Info("User sessions revoked", "user_id", user.ID, "by", c.GetString("userID"))
+	c.Status(204)
+}
+
+// Unlock handles DELETE /admin/users/:id/lockout
+// Clears the account's failed login count and any lockout. Per-IP throttling is unaffected.
+func (h *AdminHandler) Unlock(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	if err := h.limiter.Unlock(user.Email); err != nil {
+		slog.Error("Unlock: Failed to unlock account", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	slog.Info("User account unlocked", "user_id", user.ID, "by", c.GetString("userID"))
+	c.Status(204)
+}
+
+// ResetMFA handles DELETE /admin/users/:id/2fa
+// Turns off 2FA for a user who lost both their authenticator and their recovery codes
+func (h *AdminHandler) ResetMFA(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	if err := disableMFA(h.db, user.ID); err != nil {
+		slog.Error("ResetMFA: Failed to disable 2FA", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to reset 2FA"})
+		return
+	}
+
+	slog.Info("User 2FA reset", "user_id", user.ID, "by", c.GetString("userID"))
+	c.Status(204)
+}
+
+// DeleteUser handles DELETE /admin/users/:id
+// Soft-deletes the account (it can no longer log in) and revokes its sessions.
+// The user's tasks in the API service are kept.
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+	if h.isSelf(c, user) {
+		c.JSON(409, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, user.ID)
+	})
+	if err != nil {
+		slog.Error("DeleteUser: Failed to delete user", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to delete user"})
+		return
+	}
+
+	slog.Info("User deleted", "user_id", user.ID, "by", c.GetString("userID"))
+	c.Status(204)
+}
+
+// loadUser loads the user named by the :id parameter with its roles,
+// writing an error response if it does not exist.
+func (h *AdminHandler) loadUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid user id"})
+		return user, false
+	}
+
+	err = h.db.Preload("Roles").First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(404, gin.H{"error": "User not found"})
+		return user, false
+	}
+	if err != nil {
+		slog.Error("Admin: Failed to load user", "user_id", id, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to load user"})
+		return user, false
+	}
+	return user, true
+}
+
+// isSelf reports whether user is the admin making the request.
+func (h *AdminHandler) isSelf(c *gin.Context, user models.User) bool {
+	return c.GetString("userID") == strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// revokeUserSessions revokes all of the user's active sessions.
+func revokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
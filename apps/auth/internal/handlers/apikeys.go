@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/auth/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/rbac"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+	"gorm.io/gorm"
+)
+
+// API key limits
+const (
+	MaxAPIKeysPerUser = 20
+	MaxAPIKeyNameLen  = 100
+)
+
+// lastUsedResolution limits how often last_used_at is written for a busy key
+const lastUsedResolution = time.Minute
+
+// errInvalidAPIKey covers unknown, expired and revoked API keys
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyHandler serves the API key endpoints under /api-keys.
+// Routes must be protected with RequireAuth, so keys are managed with a user's
+// access token and never with another API key.
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler.
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// apiKeyView is the listing view of a key; the key itself is only returned by Create.
+type apiKeyView struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func toAPIKeyView(k models.APIKey) apiKeyView {
+	return apiKeyView{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
+
+// Create handles POST /api-keys
+// Body: {"name": "...", "scopes": ["tasks:read", ...], "expires_in_days": 90}
+// The scopes must be a subset of the caller's own. The key is returned only once.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days"` // 0: never expires
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	if len(req.Name) > MaxAPIKeyNameLen {
+		c.JSON(400, gin.H{"error": "name must be at most " + strconv.Itoa(MaxAPIKeyNameLen) + " characters"})
+		return
+	}
+	if len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+		c.JSON(400, gin.H{"error": "scopes must not be empty and expires_in_days must not be negative"})
+		return
+	}
+	granted := c.GetStringSlice("scopes")
+	for _, scope := range req.Scopes {
+		if !slices.Contains(granted, scope) {
+			c.JSON(403, gin.H{"error": "Cannot grant scope " + scope})
+			return
+		}
+	}
+
+	userID, err := strconv.ParseUint(c.GetString("userID"), 10, 64)
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	var active int64
+	err = h.db.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active).Error
+	if err != nil {
+		slog.Error("CreateAPIKey: Failed to count keys", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	if active >= MaxAPIKeysPerUser {
+		c.JSON(409, gin.H{"error": "API key limit reached; revoke an unused key first"})
+		return
+	}
+
+	token, _, err := utils.NewOpaqueToken()
+	if err != nil {
+		slog.Error("CreateAPIKey: Failed to generate key", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	key := models.APIKeyPrefix + token
+
+	slices.Sort(req.Scopes)
+	apiKey := models.APIKey{
+		UserID:  uint(userID),
+		Name:    req.Name,
+		Prefix:  key[:len(models.APIKeyPrefix)+8],
+		KeyHash: utils.HashToken(key),
+		Scopes:  slices.Compact(req.Scopes),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := h.db.Create(&apiKey).Error; err != nil {
+		slog.Error("CreateAPIKey: Failed to save key", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	slog.Info("API key created", "user_id", userID, "key_id", apiKey.ID, "scopes", apiKey.Scopes)
+	c.JSON(201, gin.H{
+		"api_key": toAPIKeyView(apiKey),
+		"key":     key, // Only returned here
+	})
+}
+
+// List handles GET /api-keys
+// Lists the caller's keys, including revoked ones, newest first
+func (h *APIKeyHandler) List(c *gin.Context) {
+	var keys []models.APIKey
+	err := h.db.Where("user_id = ?", c.GetString("userID")).Order("id DESC").Find(&keys).Error
+	if err != nil {
+		slog.Error("ListAPIKeys: Failed to list keys", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	out := make([]apiKeyView, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, toAPIKeyView(k))
+	}
+	c.JSON(200, gin.H{"api_keys": out})
+}
+
+// Revoke handles DELETE /api-keys/:id
+// Revoked keys stay listed so their last use remains visible
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid API key id"})
+		return
+	}
+
+	res := h.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, c.GetString("userID")).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		slog.Error("RevokeAPIKey: Failed to revoke key", "key_id", id, "error", res.Error)
+		c.JSON(500, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(404, gin.H{"error": "API key not found"})
+		return
+	}
+
+	slog.Info("API key revoked", "key_id", id, "user_id", c.GetString("userID"))
+	c.Status(204)
+}
+
+// validateAPIKey answers GET /validate for an X-API-Key header. The key's scopes are
+// limited to the owner's current role scopes, so demoting a user also restricts their keys.
+func (h *AuthHandler) validateAPIKey(c *gin.Context, key string) {
+	apiKey, scopes, err := verifyAPIKey(h.db, key)
+	if errors.Is(err, errInvalidAPIKey) {
+		metrics.APIKeyValidationsTotal.WithLabelValues("invalid").Inc()
+		c.JSON(401, gin.H{"valid": false})
+		return
+	}
+	if err != nil {
+		slog.Error("Validate: Failed to verify API key", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to verify API key"})
+		return
+	}
+
+	metrics.APIKeyValidationsTotal.WithLabelValues("valid").Inc()
+	c.JSON(200, gin.H{
+		"valid":      true,
+		"user_id":    strconv.FormatUint(uint64(apiKey.UserID), 10),
+		"scopes":     scopes,
+		"api_key_id": apiKey.ID,
+	})
+}
+
+// verifyAPIKey looks up an active key, records its use and returns its effective scopes.
+func verifyAPIKey(db *gorm.DB, key string) (models.APIKey, []string, error) {
+	var apiKey models.APIKey
+	err := db.Where("key_hash = ?", utils.HashToken(key)).First(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apiKey, nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return apiKey, nil, err
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		return apiKey, nil, errInvalidAPIKey
+	}
+
+	// Effective scopes: the key's, limited to the owner's current ones.
+	// Deleted users have no grants, so their keys stop working.
+	_, granted, err := rbac.Grants(db, apiKey.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apiKey, nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return apiKey, nil, err
+	}
+	scopes := make([]string, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		if slices.Contains(granted, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	// Last-used tracking, at most once per lastUsedResolution
+	err = db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-lastUsedResolution)).
+		Update("last_used_at", now).Error
+	if err != nil {
+		slog.Warn("Failed to record API key use", "key_id", apiKey.ID, "error", err)
+	}
+
+	return apiKey, scopes, nil
+}
@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/auth/internal/keys"
+	"github.com/sanjain/pixelflow/apps/auth/internal/lockout"
+	"github.com/sanjain/pixelflow/apps/auth/internal/mailer"
+	"github.com/sanjain/pixelflow/apps/auth/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/rbac"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errInvalidRefreshToken covers unknown, expired and revoked refresh tokens
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Config configures the AuthHandler.
+type Config struct {
+	AccessTTL            time.Duration // Lifetime of access tokens (JWTs)
+	RefreshTTL           time.Duration // Lifetime of each refresh token; a session stays alive as long as it keeps refreshing
+	AdminEmails          []string      // Accounts registered with these emails become admins
+	AppURL               string        // Frontend base URL, for the links in emails
+	RequireVerifiedEmail bool          // Refuse logins until the email address is verified
+	VerificationTTL      time.Duration // Lifetime of email verification links
+	PasswordResetTTL     time.Duration // Lifetime of password reset links
+}
+
+// AuthHandler serves the authentication endpoints.
+type AuthHandler struct {
+	db      *gorm.DB
+	keys    *keys.KeySet
+	mailer  mailer.Mailer
+	limiter *lockout.Limiter
+	cfg     Config
+	admins  map[string]bool // Emails that get the admin role at registration
+
+	background sync.WaitGroup // Emails being sent after the response, see requestEmail
+}
+
+// NewAuthHandler creates a new AuthHandler.
+// ks: Keys used to sign and verify access tokens
+// m: Sends verification and password reset emails
+// limiter: Throttles failed logins per account and per IP
+func NewAuthHandler(db *gorm.DB, ks *keys.KeySet, m mailer.Mailer, limiter *lockout.Limiter, cfg Config) *AuthHandler {
+	admins := make(map[string]bool, len(cfg.AdminEmails))
+	for _, email := range cfg.AdminEmails {
+		admins[email] = true
+	}
+	return &AuthHandler{
+		db:      db,
+		keys:    ks,
+		mailer:  m,
+		limiter: limiter,
+		cfg:     cfg,
+		admins:  admins,
+	}
+}
+
+// Register handles POST /register
+// Creates a new user account with hashed password and emails a verification link
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Register: Invalid request body", "error", err)
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Check if user exists
+	var existing models.User
+	if err := h.db.Where("email = ?", req.Email).First(&existing).Error; err == nil {
+		slog.Warn("Register: User already exists", "email", req.Email)
+		c.JSON(400, gin.H{"error": "User already exists"})
+		return
+	}
+
+	// Hash password
+	hashedPw, err := utils.HashPassword(req.Password)
+	if err != nil {
+		slog.Error("Register: Failed to hash password", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Create user
+	user := models.User{
+		Email:    req.Email,
+		Password: hashedPw,
+	}
+
+	// Create the user with its default roles and a verification token
+	var verifyToken string
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := rbac.GrantRole(tx, &user, models.RoleUser); err != nil {
+			return err
+		}
+		if h.admins[req.Email] {
+			if err := rbac.GrantRole(tx, &user, models.RoleAdmin); err != nil {
+				return err
+			}
+		}
+		verifyToken, err = issueEmailToken(tx, user.ID, models.PurposeVerifyEmail, h.cfg.VerificationTTL)
+		return err
+	})
+	if err != nil {
+		slog.Error("Register: Failed to create user in DB", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	// Record business metric
+	metrics.RegistrationsTotal.Inc()
+
+	// Send the verification email once the account is committed
+	h.sendEmail(c.Request.Context(), user.Email, models.PurposeVerifyEmail, verifyToken)
+
+	slog.Info("User registered successfully", "email", req.Email, "user_id", user.ID)
+	c.JSON(200, gin.H{"message": "User registered successfully; check your email to verify your address"})
+}
+
+// Login handles POST /login
+// Authenticates user and starts a session with an access and a refresh token
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Login: Invalid request body", "error", err)
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// Check throttling before looking at the password, so locked out guesses learn nothing.
+	// The attempt counts as a failure until it turns out otherwise.
+	ip := c.ClientIP()
+	attempt, wait, err := h.limiter.Check(req.Email, ip)
+	if err != nil {
+		slog.Error("Login: Failed to check login throttle", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if wait > 0 {
+		metrics.LoginsTotal.WithLabelValues("locked").Inc()
+		slog.Warn("Login: Too many failed attempts", "email", req.Email, "ip", ip, "retry_after", wait.String())
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(429, gin.H{"error": "Too many failed login attempts; try again later"})
+		return
+	}
+
+	// Find user
+	var user models.User
+	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		// Unknown emails count as failures too, and still pay for a bcrypt
+		// comparison, so they look like any other account
+		utils.CheckPasswordHash(req.Password, utils.DummyPasswordHash)
+		slog.Warn("Login: User not found", "email", req.Email)
+		metrics.LoginsTotal.WithLabelValues("failure").Inc()
+		c.JSON(401, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// Check password
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		metrics.LoginsTotal.WithLabelValues("failure").Inc()
+		slog.Warn("Login: Invalid password", "email", req.Email)
+		c.JSON(401, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	// Check the email address is verified (after the password, so it reveals nothing to strangers)
+	if h.cfg.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		h.refundAttempt(attempt, req.Email)
+		metrics.LoginsTotal.WithLabelValues("unverified").Inc()
+		slog.Warn("Login: Email not verified", "email", req.Email)
+		c.JSON(403, gin.H{"error": "Email not verified"})
+		return
+	}
+
+	// With 2FA the password only earns a challenge; /login/2fa completes the login.
+	// The attempt was no failed guess, but the account's failures stay until then.
+	if user.TOTPEnabledAt != nil {
+		h.refundAttempt(attempt, req.Email)
+		challenge, err := h.createChallenge(user.ID)
+		if err != nil {
+			slog.Error("Login: Failed to create 2FA challenge", "error", err)
+			c.JSON(500, gin.H{"error": "Failed to log in"})
+			return
+		}
+		metrics.LoginsTotal.WithLabelValues("mfa_required").Inc()
+		slog.Info("Login: 2FA code required", "email", req.Email, "user_id", user.ID)
+		c.JSON(200, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	// Start Session
+	var tokens gin.H
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tokens, err = h.startSession(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		slog.Error("Login: Failed to generate token", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// Record successful login
+	h.recordSuccess(attempt, user.Email)
+	metrics.LoginsTotal.WithLabelValues("success").Inc()
+
+	slog.Info("User logged in successfully", "email", req.Email, "user_id", user.ID)
+	c.JSON(200, tokens)
+}
+
+// recordSuccess clears the account's failed logins once a login is complete,
+// i.e. after the password and, with 2FA, the code. Errors are logged only.
+func (h *AuthHandler) recordSuccess(attempt *lockout.Attempt, email string) {
+	if err := attempt.Succeed(); err != nil {
+		slog.Warn("Login: Failed to reset login throttle", "email", email, "error", err)
+	}
+}
+
+// refundAttempt stops counting an attempt that was not a failed guess. Errors are logged only.
+func (h *AuthHandler) refundAttempt(attempt *lockout.Attempt, email string) {
+	if err := attempt.Refund(); err != nil {
+		slog.Warn("Login: Failed to refund login attempt", "email", email, "error", err)
+	}
+}
+
+// Refresh handles POST /refresh
+// Exchanges a refresh token for a new access token and a new refresh token.
+// Refresh tokens are single use: presenting one that was already exchanged means it
+// leaked (or the client raced itself), so the whole session is revoked.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var tokens gin.H
+	reused := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the token row so concurrent refreshes with the same token serialize
+		var rt models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", utils.HashToken(req.RefreshToken)).
+			First(&rt).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		var session models.Session
+		if err := tx.First(&session, "id = ?", rt.SessionID).Error; err != nil {
+			return err
+		}
+		if session.RevokedAt != nil {
+			return errInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if rt.UsedAt != nil {
+			// Reuse detected: revoke the session (committed), then reject the request
+			reused = true
+			return tx.Model(&session).Update("revoked_at", now).Error
+		}
+		if now.After(rt.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		// Rotate
+		if err := tx.Model(&rt).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		tokens, err = h.issueTokens(tx, session.UserID, session.ID)
+		return err
+	})
+
+	switch {
+	case reused:
+		metrics.TokenRefreshesTotal.WithLabelValues("reused").Inc()
+		slog.Warn("Refresh: Refresh token reused, session revoked")
+		c.JSON(401, gin.H{"error": "Invalid refresh token"})
+	case errors.Is(err, errInvalidRefreshToken):
+		metrics.TokenRefreshesTotal.WithLabelValues("invalid").Inc()
+		c.JSON(401, gin.H{"error": "Invalid refresh token"})
+	case err != nil:
+		slog.Error("Refresh: Failed to refresh token", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to refresh token"})
+	default:
+		metrics.TokenRefreshesTotal.WithLabelValues("success").Inc()
+		c.JSON(200, tokens)
+	}
+}
+
+// Logout handles POST /logout
+// Revokes the session identified by the refresh token in the body or, if there is
+// none, by the access token in the Authorization header. All of the session's
+// tokens stop working immediately.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.ShouldBindJSON(&req) // The body is optional
+
+	var sessionID string
+	if req.RefreshToken != "" {
+		var rt models.RefreshToken
+		if err := h.db.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&rt).Error; err == nil {
+			sessionID = rt.SessionID
+		}
+	} else if token, ok := bearerToken(c); ok {
+		if claims, err := utils.ValidateJWT(h.keys, token); err == nil {
+			sessionID = claims.SessionID
+		}
+	}
+	if sessionID == "" {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	err := h.db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+	if err != nil {
+		slog.Error("Logout: Failed to revoke session", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	slog.Info("User logged out", "session_id", sessionID)
+	c.Status(204)
+}
+
+// Validate handles GET /validate
+// Validates JWT token, checks that its session is not revoked and returns the
+// user ID with the token's roles and scopes.
+// With an X-API-Key header the API key is validated instead.
+func (h *AuthHandler) Validate(c *gin.Context) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		h.validateAPIKey(c, key)
+		return
+	}
+
+	claims, status := h.authenticate(c)
+	metrics.TokenValidationsTotal.WithLabelValues(status).Inc()
+	if claims == nil {
+		c.JSON(401, gin.H{"valid": false})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"valid":   true,
+		"user_id": claims.UserID,
+		"roles":   claims.Roles,
+		"scopes":  claims.Scopes,
+	})
+}
+
+// RequireAuth returns middleware that only lets through requests whose access token
+// is valid (including the revocation check). The user ID and the token's scopes are
+// stored in the context as "userID" and "scopes".
+// API keys are not accepted here: they cannot manage users or other keys.
+func (h *AuthHandler) RequireAuth() gin.HandlerFunc {
+	return h.RequireScope("")
+}
+
+// RequireScope is RequireAuth that additionally requires the token to carry scope.
+func (h *AuthHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, _ := h.authenticate(c)
+		if claims == nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": "Invalid or expired token"})
+			return
+		}
+		if scope != "" && !slices.Contains(claims.Scopes, scope) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "Missing scope " + scope})
+			return
+		}
+		c.Set("userID", claims.UserID)
+		c.Set("scopes", claims.Scopes)
+		c.Next()
+	}
+}
+
+// authenticate verifies the bearer token and its session. It returns the claims of a
+// valid token, or nil, with the outcome as a TokenValidationsTotal label.
+func (h *AuthHandler) authenticate(c *gin.Context) (*utils.Claims, string) {
+	token, ok := bearerToken(c)
+	if !ok {
+		return nil, "invalid"
+	}
+
+	claims, err := utils.ValidateJWT(h.keys, token)
+	if err != nil {
+		slog.Warn("Validate: Invalid token", "error", err)
+		return nil, "invalid"
+	}
+
+	// Revocation Check
+	var session models.Session
+	if err := h.db.First(&session, "id = ?", claims.SessionID).Error; err != nil || session.RevokedAt != nil {
+		slog.Warn("Validate: Session revoked or unknown", "session_id", claims.SessionID)
+		return nil, "revoked"
+	}
+	return claims, "valid"
+}
+
+// startSession creates a session for the user and issues its first tokens.
+func (h *AuthHandler) startSession(tx *gorm.DB, userID uint) (gin.H, error) {
+	sessionID, err := utils.NewID()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.Session{ID: sessionID, UserID: userID}).Error; err != nil {
+		return nil, err
+	}
+	return h.issueTokens(tx, userID, sessionID)
+}
+
+// issueTokens creates an access token and a new refresh token for the session.
+// Roles and scopes are read on every issue, so role changes apply at the next refresh.
+func (h *AuthHandler) issueTokens(tx *gorm.DB, userID uint, sessionID string) (gin.H, error) {
+	roles, scopes, err := rbac.Grants(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := utils.GenerateJWT(h.keys, utils.Claims{
+		UserID:    fmt.Sprintf("%d", userID),
+		SessionID: sessionID,
+		Roles:     roles,
+		Scopes:    scopes,
+	}, h.cfg.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	rt := models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(h.cfg.RefreshTTL),
+	}
+	if err := tx.Create(&rt).Error; err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         accessToken, // Access token
+		"token_type":    "Bearer",
+		"expires_in":    int(h.cfg.AccessTTL.Seconds()),
+		"refresh_token": refreshToken,
+	}, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(c *gin.Context) (string, bool) {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// JWKS handles GET /.well-known/jwks.json
+// Publishes the public keys that verify access tokens, including superseded keys
+// whose tokens have not expired yet
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	// Keys only change on rotation; verifiers seeing an unknown kid should refetch
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, h.keys.JWKS())
+}
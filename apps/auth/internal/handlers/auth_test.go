@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/auth/internal/dbtest"
+	"github.com/sanjain/pixelflow/apps/auth/internal/keys"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/rbac"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+	"github.com/sanjain/pixelflow/pkg/jwks"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestHandler returns an AuthHandler on a fresh database with the default roles
+// and one user.
+func newTestHandler(t *testing.T) (*AuthHandler, *gorm.DB, models.User) {
+	t.Helper()
+	db := dbtest.Open(t)
+	if err := rbac.Seed(db); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := keys.New(keys.Config{Alg: jwks.AlgEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Email: "user@example.com", Password: "unused"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := rbac.GrantRole(db, &user, models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	h := NewAuthHandler(db, ks, nil, nil, Config{AccessTTL: 15 * time.Minute, RefreshTTL: time.Hour})
+	return h, db, user
+}
+
+// refresh posts refreshToken to h.Refresh and returns the status and the response body.
+func refresh(t *testing.T, h *AuthHandler, refreshToken string) (int, map[string]any) {
+	t.Helper()
+	router := gin.New()
+	router.POST("/refresh", h.Refresh)
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/refresh", bytes.NewReader(body)))
+
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	return w.Code, resp
+}
+
+func TestRefreshRotation(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	tokens, err := h.startSession(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := tokens["refresh_token"].(string)
+	claims, err := utils.ValidateJWT(h.keys, tokens["token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID := claims.SessionID
+
+	// Each refresh token works once and is replaced by a new one in the same session
+	token := first
+	for i := range 2 {
+		code, resp := refresh(t, h, token)
+		if code != http.StatusOK {
+			t.Fatalf("refresh %d: status %d, %v", i, code, resp)
+		}
+		next := resp["refresh_token"].(string)
+		if next == token {
+			t.Fatalf("refresh %d: refresh token was not rotated", i)
+		}
+		claims, err := utils.ValidateJWT(h.keys, resp["token"].(string))
+		if err != nil || claims.SessionID != sessionID || len(claims.Scopes) == 0 {
+			t.Fatalf("refresh %d: access token claims = %+v, %v, want session %s with scopes", i, claims, err, sessionID)
+		}
+		token = next
+	}
+
+	// Replaying the first token revokes the session, including the newest token
+	if code, _ := refresh(t, h, first); code != http.StatusUnauthorized {
+		t.Fatalf("reused token: status %d, want 401", code)
+	}
+	var session models.Session
+	if err := db.First(&session, "id = ?", sessionID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if session.RevokedAt == nil {
+		t.Fatal("session not revoked after refresh token reuse")
+	}
+	if code, _ := refresh(t, h, token); code != http.StatusUnauthorized {
+		t.Fatalf("newest token of a revoked session: status %d, want 401", code)
+	}
+}
+
+func TestRefreshRejectsInvalidTokens(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	tokens, err := h.startSession(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := tokens["refresh_token"].(string)
+
+	if code, _ := refresh(t, h, "unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("unknown token: status %d, want 401", code)
+	}
+
+	// An expired token is refused without revoking the session
+	err = db.Model(&models.RefreshToken{}).Where("token_hash = ?", utils.HashToken(token)).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := refresh(t, h, token); code != http.StatusUnauthorized {
+		t.Fatalf("expired token: status %d, want 401", code)
+	}
+	var revoked int64
+	if err := db.Model(&models.Session{}).Where("revoked_at IS NOT NULL").Count(&revoked).Error; err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 0 {
+		t.Fatal("expired refresh token revoked its session")
+	}
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sanjain/pixelflow/apps/auth/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 2FA settings
+const (
+	totpIssuer           = "PixelFlow"     // Shown by authenticator apps
+	mfaChallengeTTL      = 5 * time.Minute // Time between the password and the code at login
+	maxChallengeAttempts = 5               // Wrong codes before a challenge is spent
+	recoveryCodeCount    = 10
+)
+
+// errInvalidChallenge covers unknown, used, expired and exhausted login challenges
+var errInvalidChallenge = errors.New("invalid login challenge")
+
+// MFAStatus handles GET /2fa
+// Reports whether 2FA is enabled and how many recovery codes are left
+func (h *AuthHandler) MFAStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var remaining int64
+	err := h.db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining).Error
+	if err != nil {
+		slog.Error("MFAStatus: Failed to count recovery codes", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to load 2FA status"})
+		return
+	}
+	c.JSON(200, gin.H{
+		"enabled":                  user.TOTPEnabledAt != nil,
+		"enabled_at":               user.TOTPEnabledAt,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupMFA handles POST /2fa/setup
+// Generates a new TOTP secret and returns it with its otpauth:// URI (for a QR code).
+// 2FA stays off until EnableMFA confirms a code from the authenticator app.
+func (h *AuthHandler) SetupMFA(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(409, gin.H{"error": "2FA is already enabled"})
+		return
+	}
+
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		slog.Error("SetupMFA: Failed to generate secret", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to set up 2FA"})
+		return
+	}
+	err = h.db.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error
+	if err != nil {
+		slog.Error("SetupMFA: Failed to save secret", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to set up 2FA"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// EnableMFA handles POST /2fa/enable
+// Body: {"code": "123456"} from the authenticator app set up by SetupMFA.
+// Returns the recovery codes; they are shown only once.
+func (h *AuthHandler) EnableMFA(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		c.JSON(409, gin.H{"error": "2FA is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(400, gin.H{"error": "Call /2fa/setup first"})
+		return
+	}
+
+	var codes []string
+	valid := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if valid, err = useTOTP(tx, user, req.Code); err != nil || !valid {
+			return err
+		}
+		if err := tx.Model(&user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		slog.Error("EnableMFA: Failed to enable 2FA", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to enable 2FA"})
+		return
+	}
+	if !valid {
+		metrics.MFAVerificationsTotal.WithLabelValues("totp", "failure").Inc()
+		c.JSON(400, gin.H{"error": "Invalid code"})
+		return
+	}
+	metrics.MFAVerificationsTotal.WithLabelValues("totp", "success").Inc()
+
+	slog.Info("2FA enabled", "user_id", user.ID)
+	c.JSON(200, gin.H{"recovery_codes": codes})
+}
+
+// DisableMFA handles POST /2fa/disable
+// Body: {"password": "...", "code": "123456 or a recovery code"}
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(409, gin.H{"error": "2FA is not enabled"})
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.Password) {
+		c.JSON(401, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	valid := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if valid, err = h.checkSecondFactor(tx, user, req.Code); err != nil || !valid {
+			return err
+		}
+		return disableMFA(tx, user.ID)
+	})
+	if err != nil {
+		slog.Error("DisableMFA: Failed to disable 2FA", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to disable 2FA"})
+		return
+	}
+	if !valid {
+		c.JSON(400, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	slog.Info("2FA disabled", "user_id", user.ID)
+	c.Status(204)
+}
+
+// RegenerateRecoveryCodes handles POST /2fa/recovery-codes
+// Body: {"code": "123456"}. Replaces all recovery codes; the new ones are shown only once.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		c.JSON(409, gin.H{"error": "2FA is not enabled"})
+		return
+	}
+
+	var codes []string
+	valid := false
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if valid, err = useTOTP(tx, user, req.Code); err != nil || !valid {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		slog.Error("RegenerateRecoveryCodes: Failed to replace codes", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+	if !valid {
+		metrics.MFAVerificationsTotal.WithLabelValues("totp", "failure").Inc()
+		c.JSON(400, gin.H{"error": "Invalid code"})
+		return
+	}
+	metrics.MFAVerificationsTotal.WithLabelValues("totp", "success").Inc()
+
+	slog.Info("Recovery codes regenerated", "user_id", user.ID)
+	c.JSON(200, gin.H{"recovery_codes": codes})
+}
+
+// LoginMFA handles POST /login/2fa
+// Body: {"challenge_token": "...", "code": "123456 or a recovery code"}
+// Second step of the login of a user with 2FA: exchanges the challenge from /login
+// and a valid code for an access and a refresh token.
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var challenge models.MFAChallenge
+	err := h.db.Where("token_hash = ?", utils.HashToken(req.ChallengeToken)).First(&challenge).Error
+	if err == nil && !challengeUsable(challenge) {
+		err = errInvalidChallenge
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errInvalidChallenge) {
+		c.JSON(401, gin.H{"error": "Invalid or expired login challenge; log in again"})
+		return
+	}
+	if err != nil {
+		slog.Error("LoginMFA: Failed to load challenge", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, challenge.UserID).Error; err != nil || user.TOTPEnabledAt == nil {
+		c.JSON(401, gin.H{"error": "Invalid or expired login challenge; log in again"})
+		return
+	}
+
+	// Wrong codes count towards the same throttling as wrong passwords
+	ip := c.ClientIP()
+	attempt, wait, err := h.limiter.Check(user.Email, ip)
+	if err != nil {
+		slog.Error("LoginMFA: Failed to check login throttle", "error", err)
+		c.JSON(500, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if wait > 0 {
+		metrics.LoginsTotal.WithLabelValues("locked").Inc()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(429, gin.H{"error": "Too many failed login attempts; try again later"})
+		return
+	}
+
+	var tokens gin.H
+	valid := false
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the challenge so concurrent attempts are counted and it is exchanged once
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&challenge, challenge.ID).Error; err != nil {
+			return err
+		}
+		if !challengeUsable(challenge) {
+			return errInvalidChallenge
+		}
+
+		var err error
+		if valid, err = h.checkSecondFactor(tx, user, req.Code); err != nil {
+			return err
+		}
+		if !valid {
+			return tx.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+
+		if err := tx.Model(&challenge).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		tokens, err = h.startSession(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidChallenge) {
+		c.JSON(401, gin.H{"error": "Invalid or expired login challenge; log in again"})
+		return
+	}
+	if err != nil {
+		slog.Error("LoginMFA: Failed to complete login", "user_id", user.ID, "error", err)
+		c.JSON(500, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if !valid {
+		metrics.LoginsTotal.WithLabelValues("failure").Inc()
+		slog.Warn("LoginMFA: Invalid code", "user_id", user.ID)
+		c.JSON(401, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	h.recordSuccess(attempt, user.Email)
+	metrics.LoginsTotal.WithLabelValues("success").Inc()
+	slog.Info("User logged in successfully", "email", user.Email, "user_id", user.ID, "mfa", true)
+	c.JSON(200, tokens)
+}
+
+// createChallenge starts the second login step for a user with 2FA and returns its token.
+func (h *AuthHandler) createChallenge(userID uint) (string, error) {
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	err = h.db.Create(&models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}).Error
+	return token, err
+}
+
+// challengeUsable reports whether a challenge may still be exchanged.
+func challengeUsable(ch models.MFAChallenge) bool {
+	return ch.UsedAt == nil && ch.Attempts < maxChallengeAttempts && time.Now().Before(ch.ExpiresAt)
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery code,
+// consuming it. Successes and failures are recorded per method.
+func (h *AuthHandler) checkSecondFactor(tx *gorm.DB, user models.User, code string) (bool, error) {
+	method := "recovery"
+	var valid bool
+	var err error
+	if isTOTPCode(code) {
+		method = "totp"
+		valid, err = useTOTP(tx, user, code)
+	} else {
+		res := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+			Update("used_at", time.Now())
+		valid, err = res.RowsAffected == 1, res.Error
+		if valid {
+			slog.Info("Recovery code used", "user_id", user.ID)
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	status := "failure"
+	if valid {
+		status = "success"
+	}
+	metrics.MFAVerificationsTotal.WithLabelValues(method, status).Inc()
+	return valid, nil
+}
+
+// useTOTP checks a TOTP code and records its time step, so each code works only once.
+func useTOTP(tx *gorm.DB, user models.User, code string) (bool, error) {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	res := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	return res.RowsAffected == 1, res.Error
+}
+
+// isTOTPCode reports whether code looks like a TOTP code rather than a recovery code.
+func isTOTPCode(code string) bool {
+	if len(code) != utils.TOTPDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and returns a fresh set.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := utils.NewRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(utils.NormalizeRecoveryCode(code))}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// disableMFA turns 2FA off for the user and deletes their recovery codes.
+func disableMFA(tx *gorm.DB, userID uint) error {
+	err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":     "",
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// currentUser loads the user authenticated by RequireAuth,
+// writing an error response if it no longer exists.
+func (h *AuthHandler) currentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	err := h.db.First(&user, "id = ?", c.GetString("userID")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(401, gin.H{"error": "Invalid or expired token"})
+		return user, false
+	}
+	if err != nil {
+		slog.Error("Failed to load user", "user_id", c.GetString("userID"), "error", err)
+		c.JSON(500, gin.H{"error": "Failed to load user"})
+		return user, false
+	}
+	return user, true
+}
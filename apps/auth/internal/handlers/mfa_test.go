@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"github.com/sanjain/pixelflow/apps/auth/internal/utils"
+)
+
+// totpAt computes the code of secret for the time step containing at, the way an
+// authenticator app does.
+func totpAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/int64(utils.TOTPPeriod.Seconds())))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+// enableTOTP turns 2FA on for user with a new secret.
+func enableTOTP(t *testing.T, h *AuthHandler, user *models.User) {
+	t.Helper()
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user.TOTPSecret, user.TOTPEnabledAt = secret, &now
+	if err := h.db.Model(user).Select("TOTPSecret", "TOTPEnabledAt").Updates(user).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUseTOTPRefusesReplay(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	enableTOTP(t, h, &user)
+
+	// Stay clear of a step boundary, so "now" is the same step for useTOTP
+	now := time.Now()
+	if left := utils.TOTPPeriod - time.Duration(now.UnixNano()%int64(utils.TOTPPeriod)); left < time.Second {
+		time.Sleep(left)
+		now = time.Now()
+	}
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"previous step", totpAt(t, user.TOTPSecret, now.Add(-utils.TOTPPeriod)), true},
+		{"current step", totpAt(t, user.TOTPSecret, now), true},
+		{"current step replayed", totpAt(t, user.TOTPSecret, now), false},
+		{"older step after a newer one", totpAt(t, user.TOTPSecret, now.Add(-utils.TOTPPeriod)), false},
+	}
+	for _, tt := range tests {
+		// The handlers always pass the user as loaded before the transaction
+		var loaded models.User
+		if err := db.First(&loaded, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		got, err := useTOTP(db, loaded, tt.code)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: useTOTP = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	h, db, user := newTestHandler(t)
+	enableTOTP(t, h, &user)
+	codes, err := replaceRecoveryCodes(db, user.ID)
+	if err != nil || len(codes) == 0 {
+		t.Fatalf("replaceRecoveryCodes = %v, %v", codes, err)
+	}
+
+	// Typed in upper case without the separator, as users do
+	typed := strings.ToUpper(codes[0][:5] + codes[0][6:])
+	if ok, err := h.checkSecondFactor(db, user, typed); err != nil || !ok {
+		t.Fatalf("first use of %q = %v, %v, want true", typed, ok, err)
+	}
+	if ok, err := h.checkSecondFactor(db, user, codes[0]); err != nil || ok {
+		t.Fatalf("second use of %q = %v, %v, want false", codes[0], ok, err)
+	}
+	if ok, err := h.checkSecondFactor(db, user, codes[1]); err != nil || !ok {
+		t.Fatalf("other code %q = %v, %v, want true", codes[1], ok, err)
+	}
+}
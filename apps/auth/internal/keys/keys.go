@@ -0,0 +1,318 @@
+// Package keys manages the asymmetric keys used to sign access tokens.
+//
+// The newest key signs; older keys stay published in the JWKS and valid for
+// verification until every token they signed has expired (one access token TTL
+// after they were superseded).
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sanjain/pixelflow/pkg/jwks"
+)
+
+// reloadInterval is how often the key directory is re-read and rotation is checked.
+const reloadInterval = time.Minute
+
+// rsaKeyBits is the size of generated RSA keys.
+const rsaKeyBits = 2048
+
+// Key is a signing key pair.
+type Key struct {
+	ID        string // kid: RFC 7638 thumbprint of the public key
+	Alg       string // RS256 or EdDSA
+	Private   crypto.Signer
+	CreatedAt time.Time
+	jwk       jwks.JWK
+}
+
+// Method returns the JWT signing method for the key.
+func (k *Key) Method() jwt.SigningMethod {
+	if k.Alg == jwks.AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Public returns the public half of the key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// Config configures a KeySet.
+type Config struct {
+	Alg         string        // RS256 or EdDSA; used for generated keys
+	Dir         string        // Directory of PEM private keys; generated keys are written here. Empty keeps keys in memory only
+	RotateEvery time.Duration // Generate a new signing key when the current one is this old. 0 disables rotation
+	VerifyFor   time.Duration // How long a superseded key stays valid for verification (the access token TTL)
+}
+
+// KeySet holds the signing key and the keys still valid for verification.
+type KeySet struct {
+	cfg  Config
+	mu   sync.RWMutex
+	keys []*Key // Newest first; keys[0] signs
+}
+
+// New loads the keys in cfg.Dir, generating a signing key if there is none
+// (or the newest one is due for rotation).
+func New(cfg Config) (*KeySet, error) {
+	if cfg.Alg != jwks.AlgRS256 && cfg.Alg != jwks.AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q (want %s or %s)", cfg.Alg, jwks.AlgRS256, jwks.AlgEdDSA)
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	ks := &KeySet{cfg: cfg}
+	if err := ks.refresh(time.Now()); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Run periodically reloads the key directory (picking up keys added by operators or
+// other replicas), rotates the signing key when due and drops expired keys.
+// It blocks until ctx is cancelled.
+func (ks *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.refresh(time.Now()); err != nil {
+				slog.Error("Failed to refresh signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// Signer returns the current signing key.
+func (ks *KeySet) Signer() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[0]
+}
+
+// Lookup returns the key with the given kid, if it is still valid for verification.
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS returns the public keys valid for verification.
+func (ks *KeySet) JWKS() jwks.Set {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := jwks.Set{Keys: make([]jwks.JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	return set
+}
+
+// refresh reloads, rotates and prunes the key set.
+func (ks *KeySet) refresh(now time.Time) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	// 1. Reload from disk
+	keys := ks.keys
+	if ks.cfg.Dir != "" {
+		loaded, err := loadDir(ks.cfg.Dir)
+		if err != nil {
+			return err
+		}
+		keys = loaded
+	}
+
+	// 2. Rotate
+	if len(keys) == 0 || (ks.cfg.RotateEvery > 0 && now.Sub(keys[0].CreatedAt) >= ks.cfg.RotateEvery) {
+		key, err := generate(ks.cfg.Alg, now)
+		if err != nil {
+			return fmt.Errorf("generate signing key: %w", err)
+		}
+		if ks.cfg.Dir != "" {
+			if err := writeKey(ks.cfg.Dir, key); err != nil {
+				return fmt.Errorf("write signing key: %w", err)
+			}
+		}
+		keys = append([]*Key{key}, keys...)
+		slog.Info("Generated signing key", "kid", key.ID, "alg", key.Alg)
+	}
+
+	// 3. Prune
+	// A superseded key signed its last token when its successor was created
+	kept := []*Key{keys[0]}
+	for i := 1; i < len(keys); i++ {
+		if now.Before(keys[i-1].CreatedAt.Add(ks.cfg.VerifyFor)) {
+			kept = append(kept, keys[i])
+		}
+	}
+
+	if len(ks.keys) > 0 && kept[0].ID != ks.keys[0].ID {
+		slog.Info("Signing key rotated", "kid", kept[0].ID, "previous_kid", ks.keys[0].ID)
+	}
+	ks.keys = kept
+	return nil
+}
+
+// loadDir reads every *.pem private key in dir, newest (by modification time) first.
+func loadDir(dir string) ([]*Key, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var keys []*Key
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pem") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		private, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		key, err := newKey(private, info.ModTime())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if seen[key.ID] {
+			continue
+		}
+		seen[key.ID] = true
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// parsePrivateKey decodes a PEM encoded PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) private key.
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// generate creates a new key for alg.
+func generate(alg string, now time.Time) (*Key, error) {
+	var private crypto.Signer
+	var err error
+	if alg == jwks.AlgEdDSA {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(private, now)
+}
+
+// newKey derives the kid and algorithm from the public key.
+func newKey(private crypto.Signer, createdAt time.Time) (*Key, error) {
+	jwk, err := jwks.FromPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &Key{
+		ID:        jwk.Kid,
+		Alg:       jwk.Alg,
+		Private:   private,
+		CreatedAt: createdAt,
+		jwk:       jwk,
+	}, nil
+}
+
+// writeKey stores key as <kid>.pem (PKCS#8). The file is written under a temporary
+// name and renamed, so replicas reloading the directory never see a partial key.
+func writeKey(dir string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tmp, err := os.CreateTemp(dir, ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, key.ID+".pem")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// Creation time is tracked through the modification time
+	return os.Chtimes(path, key.CreatedAt, key.CreatedAt)
+}
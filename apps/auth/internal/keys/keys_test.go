@@ -0,0 +1,142 @@
+package keys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sanjain/pixelflow/pkg/jwks"
+)
+
+// kids returns the key IDs published in the JWKS, in order.
+func kids(ks *KeySet) []string {
+	var ids []string
+	for _, k := range ks.JWKS().Keys {
+		ids = append(ids, k.Kid)
+	}
+	return ids
+}
+
+func TestRotation(t *testing.T) {
+	ks, err := New(Config{Alg: jwks.AlgEdDSA, RotateEvery: 24 * time.Hour, VerifyFor: 15 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := ks.Signer()
+	t0 := first.CreatedAt
+
+	steps := []struct {
+		name       string
+		at         time.Duration // After the first key was created
+		rotated    bool          // A new signer is expected
+		wantKeys   int
+		firstValid bool
+	}{
+		{"before rotation is due", 23 * time.Hour, false, 1, true},
+		{"rotation due", 24 * time.Hour, true, 2, true},
+		{"old key still verifies", 24*time.Hour + 14*time.Minute, false, 2, true},
+		{"old key pruned after its tokens expired", 24*time.Hour + 15*time.Minute, false, 1, false},
+	}
+	signer := first
+	for _, step := range steps {
+		if err := ks.refresh(t0.Add(step.at)); err != nil {
+			t.Fatalf("%s: refresh: %v", step.name, err)
+		}
+		if got := ks.Signer(); (got.ID != signer.ID) != step.rotated {
+			t.Fatalf("%s: signer %s, previous %s, want rotated %v", step.name, got.ID, signer.ID, step.rotated)
+		}
+		signer = ks.Signer()
+
+		ids := kids(ks)
+		if len(ids) != step.wantKeys || ids[0] != signer.ID {
+			t.Fatalf("%s: JWKS kids = %v, want %d keys starting with the signer %s", step.name, ids, step.wantKeys, signer.ID)
+		}
+		if _, ok := ks.Lookup(first.ID); ok != step.firstValid {
+			t.Fatalf("%s: Lookup(first key) = %v, want %v", step.name, ok, step.firstValid)
+		}
+	}
+}
+
+func TestRotationDisabled(t *testing.T) {
+	ks, err := New(Config{Alg: jwks.AlgEdDSA, VerifyFor: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := ks.Signer()
+	if err := ks.refresh(first.CreatedAt.Add(365 * 24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Signer().ID != first.ID {
+		t.Fatal("key rotated with RotateEvery = 0")
+	}
+}
+
+func TestJWKSVerifiesSignedTokens(t *testing.T) {
+	for _, alg := range []string{jwks.AlgEdDSA, jwks.AlgRS256} {
+		ks, err := New(Config{Alg: alg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := ks.Signer()
+		if key.Alg != alg {
+			t.Fatalf("%s: signer alg = %s", alg, key.Alg)
+		}
+
+		token := jwt.NewWithClaims(key.Method(), jwt.MapClaims{"sub": "1"})
+		token.Header["kid"] = key.ID
+		signed, err := token.SignedString(key.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A verifier only has the published set
+		set := ks.JWKS()
+		_, err = jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			jwk, ok := set.Lookup(kid)
+			if !ok {
+				t.Fatalf("%s: kid %q not in JWKS", alg, kid)
+			}
+			if jwk.Alg != alg || jwk.Use != "sig" || jwk.Kid != jwk.Thumbprint() {
+				t.Fatalf("%s: JWK = %+v, want alg %s, use sig and the thumbprint as kid", alg, jwk, alg)
+			}
+			return jwk.PublicKey()
+		})
+		if err != nil {
+			t.Fatalf("%s: verify with JWKS: %v", alg, err)
+		}
+	}
+}
+
+func TestKeysPersistInDir(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{Alg: jwks.AlgEdDSA, Dir: dir, RotateEvery: 24 * time.Hour, VerifyFor: time.Hour}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another replica (or a restart) signs with the same key
+	b, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Signer().ID != b.Signer().ID {
+		t.Fatalf("second KeySet signs with %s, want %s", b.Signer().ID, a.Signer().ID)
+	}
+
+	// A key rotated by one replica is picked up by the other at its next refresh
+	due := a.Signer().CreatedAt.Add(24 * time.Hour)
+	if err := a.refresh(due); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.refresh(due.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Signer().ID != b.Signer().ID {
+		t.Fatalf("after rotation: replicas sign with %s and %s", a.Signer().ID, b.Signer().ID)
+	}
+	if len(kids(b)) != 2 {
+		t.Fatalf("JWKS after rotation = %v, want new and previous key", kids(b))
+	}
+}
@@ -0,0 +1,252 @@
+// Package lockout throttles password guessing on /login. Failed logins are counted
+// per account and per client IP in Postgres, so every replica of the Auth Service
+// sees the same counts. After a few failures each further attempt must wait an
+// exponentially growing delay, and after MaxFailures the key is locked out.
+// Every allowed attempt is counted as a failure when it starts, and taken back
+// when it succeeds, so parallel guesses cannot slip through on a stale count.
+package lockout
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/auth/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Delay applied once a key passes ThrottleAfter failures; doubles with each failure
+const (
+	baseDelay = time.Second
+	maxDelay  = 30 * time.Second
+)
+
+// sweepInterval is how often forgotten throttle rows are deleted
+const sweepInterval = time.Hour
+
+// Policy limits failed logins for one kind of key.
+type Policy struct {
+	ThrottleAfter int           // Failures before attempts are delayed
+	MaxFailures   int           // Failures before the key is locked out (0: never)
+	Lockout       time.Duration // How long a lockout lasts
+}
+
+// Config configures a Limiter.
+type Config struct {
+	Account Policy        // Per email address, whether or not the account exists
+	IP      Policy        // Per client IP, across all accounts
+	Window  time.Duration // Failures older than this are forgotten
+}
+
+// Limiter records failed logins and decides whether a login may be attempted.
+type Limiter struct {
+	db  *gorm.DB
+	cfg Config
+}
+
+// New creates a Limiter.
+func New(db *gorm.DB, cfg Config) *Limiter {
+	return &Limiter{db: db, cfg: cfg}
+}
+
+// Run deletes forgotten throttle rows periodically until ctx is cancelled.
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			err := l.db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-l.cfg.Window), now).
+				Delete(&models.LoginThrottle{}).Error
+			if err != nil {
+				slog.Warn("Failed to sweep login throttles", "error", err)
+			}
+		}
+	}
+}
+
+// Attempt is a login attempt reserved by Check. It already counts as a failure;
+// Succeed or Refund take that back once the outcome is known.
+type Attempt struct {
+	limiter *Limiter
+	email   string
+	keys    []reservedKey
+}
+
+// reservedKey remembers what Check changed on one key, so Refund can undo it.
+type reservedKey struct {
+	key         string
+	lockedUntil *time.Time // Lockout started by this attempt, if any
+	prevLocked  *time.Time // locked_until before this attempt
+}
+
+// Check reserves a login attempt for email from ip. If the attempt is allowed it is
+// recorded as a failure right away and returned; otherwise Check returns how long
+// the caller must wait and a nil Attempt. Checking and recording happen under a row
+// lock, so concurrent requests cannot all pass on the same count.
+func (l *Limiter) Check(email, ip string) (*Attempt, time.Duration, error) {
+	now := time.Now().Truncate(time.Microsecond) // Postgres precision, see Refund
+	policies := map[string]Policy{accountKey(email): l.cfg.Account, ipKey(ip): l.cfg.IP}
+
+	var attempt *Attempt
+	var wait time.Duration
+	err := l.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure both rows exist so there is something to lock; new rows have no failures.
+		// Keys are always handled in the same order ("account:" < "ip:"), so requests cannot deadlock.
+		fresh := []models.LoginThrottle{
+			{Key: accountKey(email), LastFailureAt: now},
+			{Key: ipKey(ip), LastFailureAt: now},
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fresh).Error; err != nil {
+			return err
+		}
+
+		var rows []models.LoginThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key IN ?", []string{accountKey(email), ipKey(ip)}).
+			Order("key").
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			wait = max(wait, l.waitFor(row, policies[row.Key], now))
+		}
+		if wait > 0 {
+			return nil
+		}
+
+		// Allowed: count the attempt as a failure until told otherwise
+		a := &Attempt{limiter: l, email: email}
+		for _, row := range rows {
+			reserved, err := l.reserve(tx, row, policies[row.Key], now)
+			if err != nil {
+				return err
+			}
+			a.keys = append(a.keys, reserved)
+		}
+		attempt = a
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return attempt, wait, nil
+}
+
+// reserve records one attempt on a locked row, locking the key out when it reaches its limit.
+// Failures start over when the previous one is outside the window.
+func (l *Limiter) reserve(tx *gorm.DB, row models.LoginThrottle, policy Policy, now time.Time) (reservedKey, error) {
+	reserved := reservedKey{key: row.Key, prevLocked: row.LockedUntil}
+
+	failures := row.Failures + 1
+	if row.LastFailureAt.Before(now.Add(-l.cfg.Window)) {
+		failures = 1
+	}
+	updates := map[string]any{"failures": failures, "last_failure_at": now}
+	if policy.MaxFailures > 0 && failures >= policy.MaxFailures {
+		until := now.Add(policy.Lockout)
+		updates["locked_until"] = until
+		reserved.lockedUntil = &until
+	}
+	if err := tx.Model(&models.LoginThrottle{}).Where("key = ?", row.Key).Updates(updates).Error; err != nil {
+		return reserved, err
+	}
+
+	if reserved.lockedUntil != nil {
+		scope := "account"
+		if strings.HasPrefix(row.Key, "ip:") {
+			scope = "ip"
+		}
+		metrics.LoginLockoutsTotal.WithLabelValues(scope).Inc()
+		slog.Warn("Login locked out", "key", row.Key, "failures", failures, "until", *reserved.lockedUntil)
+	}
+	return reserved, nil
+}
+
+// waitFor returns the remaining lockout or throttling delay of one key.
+func (l *Limiter) waitFor(row models.LoginThrottle, policy Policy, now time.Time) time.Duration {
+	if row.LockedUntil != nil && now.Before(*row.LockedUntil) {
+		return row.LockedUntil.Sub(now)
+	}
+	if row.LastFailureAt.Before(now.Add(-l.cfg.Window)) || row.Failures < policy.ThrottleAfter {
+		return 0
+	}
+
+	// Progressive delay: 1s, 2s, 4s, ... after the last failure
+	delay := maxDelay
+	if shift := row.Failures - policy.ThrottleAfter; shift < 5 {
+		delay = min(baseDelay<<shift, maxDelay)
+	}
+	return max(row.LastFailureAt.Add(delay).Sub(now), 0)
+}
+
+// Succeed ends a completed login: a correct password, plus a correct code when the
+// account has 2FA. It clears the account's failures and takes the attempt back
+// from the IP, whose other failures are kept, so one valid account cannot reset
+// an attacker's budget. A correct password alone must use Refund instead, or it
+// would also reset the budget for guessing codes.
+func (a *Attempt) Succeed() error {
+	if err := a.limiter.Unlock(a.email); err != nil {
+		return err
+	}
+	for _, k := range a.keys {
+		if strings.HasPrefix(k.key, "ip:") {
+			if err := a.limiter.refund(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Refund takes the attempt back on both keys, for attempts that turned out not to
+// be failed guesses (e.g. a correct password that still needs its 2FA code).
+func (a *Attempt) Refund() error {
+	for _, k := range a.keys {
+		if err := a.limiter.refund(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refund removes one failure from a key and lifts the lockout this attempt started,
+// unless a later attempt has replaced it.
+func (l *Limiter) refund(k reservedKey) error {
+	updates := map[string]any{"failures": gorm.Expr("GREATEST(failures - 1, 0)")}
+	if k.lockedUntil != nil {
+		updates["locked_until"] = gorm.Expr("CASE WHEN locked_until = ? THEN ? ELSE locked_until END", *k.lockedUntil, k.prevLocked)
+	}
+	return l.db.Model(&models.LoginThrottle{}).Where("key = ?", k.key).Updates(updates).Error
+}
+
+// Unlock clears the failures and any lockout of email.
+func (l *Limiter) Unlock(email string) error {
+	return l.db.Where("key = ?", accountKey(email)).Delete(&models.LoginThrottle{}).Error
+}
+
+// LockedUntil returns when the lockout of email ends, or nil if it is not locked out.
+func (l *Limiter) LockedUntil(email string) (*time.Time, error) {
+	var rows []models.LoginThrottle
+	err := l.db.Where("key = ? AND locked_until > ?", accountKey(email), time.Now()).Limit(1).Find(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return rows[0].LockedUntil, nil
+}
+
+// accountKey normalizes email so case variants share one counter.
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
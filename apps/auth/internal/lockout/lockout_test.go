@@ -0,0 +1,213 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/auth/internal/dbtest"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	testEmail = "user@example.com"
+	testIP    = "203.0.113.7"
+)
+
+// newLimiter returns a Limiter that locks an account out after maxFailures
+// and never delays attempts before that.
+func newLimiter(t *testing.T, maxFailures int) (*Limiter, *gorm.DB) {
+	db := dbtest.Open(t)
+	return New(db, Config{
+		Account: Policy{ThrottleAfter: 100, MaxFailures: maxFailures, Lockout: 15 * time.Minute},
+		IP:      Policy{ThrottleAfter: 100, Lockout: 15 * time.Minute},
+		Window:  15 * time.Minute,
+	}), db
+}
+
+// throttle returns the row of key, or a zero row if there is none.
+func throttle(t *testing.T, db *gorm.DB, key string) models.LoginThrottle {
+	t.Helper()
+	var rows []models.LoginThrottle
+	if err := db.Where("key = ?", key).Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 {
+		return models.LoginThrottle{}
+	}
+	return rows[0]
+}
+
+// check reserves an attempt that must be allowed.
+func check(t *testing.T, l *Limiter, email string) *Attempt {
+	t.Helper()
+	attempt, wait, err := l.Check(email, testIP)
+	if err != nil || attempt == nil {
+		t.Fatalf("Check(%s) = %v, %v, %v, want an attempt", email, attempt, wait, err)
+	}
+	return attempt
+}
+
+func TestCheckCountsAttempts(t *testing.T) {
+	l, db := newLimiter(t, 0)
+	var attempts []*Attempt
+	for range 3 {
+		attempts = append(attempts, check(t, l, testEmail))
+	}
+	// Case and spacing variants of the email share the account counter
+	attempts = append(attempts, check(t, l, " User@Example.com"))
+
+	if got := throttle(t, db, accountKey(testEmail)).Failures; got != 4 {
+		t.Fatalf("account failures = %d, want 4", got)
+	}
+	if got := throttle(t, db, ipKey(testIP)).Failures; got != 4 {
+		t.Fatalf("ip failures = %d, want 4", got)
+	}
+
+	// Refund takes one attempt back from both keys
+	if err := attempts[0].Refund(); err != nil {
+		t.Fatal(err)
+	}
+	if a, ip := throttle(t, db, accountKey(testEmail)).Failures, throttle(t, db, ipKey(testIP)).Failures; a != 3 || ip != 3 {
+		t.Fatalf("after Refund: account %d, ip %d failures, want 3, 3", a, ip)
+	}
+
+	// Succeed clears the account but only takes its own attempt back from the IP
+	if err := attempts[1].Succeed(); err != nil {
+		t.Fatal(err)
+	}
+	if row := throttle(t, db, accountKey(testEmail)); row.Key != "" {
+		t.Fatalf("after Succeed: account row = %+v, want deleted", row)
+	}
+	if got := throttle(t, db, ipKey(testIP)).Failures; got != 2 {
+		t.Fatalf("after Succeed: ip failures = %d, want 2", got)
+	}
+}
+
+func TestCheckForgetsFailuresOutsideWindow(t *testing.T) {
+	l, db := newLimiter(t, 0)
+	check(t, l, testEmail)
+	check(t, l, testEmail)
+
+	err := db.Model(&models.LoginThrottle{}).Where("key = ?", accountKey(testEmail)).
+		Update("last_failure_at", time.Now().Add(-16*time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(t, l, testEmail)
+	if got := throttle(t, db, accountKey(testEmail)).Failures; got != 1 {
+		t.Fatalf("failures after the window = %d, want 1", got)
+	}
+	if got := throttle(t, db, ipKey(testIP)).Failures; got != 3 {
+		t.Fatalf("ip failures = %d, want 3", got)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	l, _ := newLimiter(t, 3)
+	for range 3 {
+		check(t, l, testEmail)
+	}
+
+	attempt, wait, err := l.Check(testEmail, testIP)
+	if err != nil || attempt != nil {
+		t.Fatalf("Check after 3 failures = %v, %v, want no attempt", attempt, err)
+	}
+	if wait <= 14*time.Minute || wait > 15*time.Minute {
+		t.Fatalf("wait = %v, want about 15m", wait)
+	}
+	until, err := l.LockedUntil(testEmail)
+	if err != nil || until == nil {
+		t.Fatalf("LockedUntil = %v, %v, want a time", until, err)
+	}
+
+	// Other accounts from the same IP are not affected
+	check(t, l, "other@example.com")
+
+	if err := l.Unlock(testEmail); err != nil {
+		t.Fatal(err)
+	}
+	check(t, l, testEmail)
+}
+
+func TestRefundLiftsItsLockout(t *testing.T) {
+	expired := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	later := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+
+	tests := []struct {
+		name        string
+		prevLocked  *time.Time // locked_until before the locking attempt
+		replacedBy  *time.Time // locked_until set by a later attempt before the refund
+		wantLocked  *time.Time
+		wantLockout bool // Still locked out after the refund
+	}{
+		{"never locked before", nil, nil, nil, false},
+		{"earlier lockout expired", &expired, nil, &expired, false},
+		{"replaced by a later lockout", nil, &later, &later, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, db := newLimiter(t, 3)
+			key := accountKey(testEmail)
+			check(t, l, testEmail)
+			check(t, l, testEmail)
+			if tt.prevLocked != nil {
+				if err := db.Model(&models.LoginThrottle{}).Where("key = ?", key).Update("locked_until", *tt.prevLocked).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			attempt := check(t, l, testEmail) // Third failure: locks the account
+			if until, _ := l.LockedUntil(testEmail); until == nil {
+				t.Fatal("third attempt did not lock the account")
+			}
+			if tt.replacedBy != nil {
+				if err := db.Model(&models.LoginThrottle{}).Where("key = ?", key).Update("locked_until", *tt.replacedBy).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := attempt.Refund(); err != nil {
+				t.Fatal(err)
+			}
+			row := throttle(t, db, key)
+			if row.Failures != 2 {
+				t.Errorf("failures = %d, want 2", row.Failures)
+			}
+			if (row.LockedUntil == nil) != (tt.wantLocked == nil) || (row.LockedUntil != nil && !row.LockedUntil.Equal(*tt.wantLocked)) {
+				t.Errorf("locked_until = %v, want %v", row.LockedUntil, tt.wantLocked)
+			}
+			if until, _ := l.LockedUntil(testEmail); (until != nil) != tt.wantLockout {
+				t.Errorf("LockedUntil = %v, want locked out %v", until, tt.wantLockout)
+			}
+		})
+	}
+}
+
+func TestWaitFor(t *testing.T) {
+	l := New(nil, Config{Window: 15 * time.Minute})
+	policy := Policy{ThrottleAfter: 3, MaxFailures: 10, Lockout: 15 * time.Minute}
+	now := time.Now()
+	locked := now.Add(5 * time.Minute)
+
+	tests := []struct {
+		name string
+		row  models.LoginThrottle
+		want time.Duration
+	}{
+		{"below threshold", models.LoginThrottle{Failures: 2, LastFailureAt: now}, 0},
+		{"first delay", models.LoginThrottle{Failures: 3, LastFailureAt: now}, time.Second},
+		{"doubles", models.LoginThrottle{Failures: 5, LastFailureAt: now}, 4 * time.Second},
+		{"capped", models.LoginThrottle{Failures: 9, LastFailureAt: now}, maxDelay},
+		{"partly elapsed", models.LoginThrottle{Failures: 4, LastFailureAt: now.Add(-time.Second)}, time.Second},
+		{"elapsed", models.LoginThrottle{Failures: 4, LastFailureAt: now.Add(-10 * time.Second)}, 0},
+		{"outside window", models.LoginThrottle{Failures: 9, LastFailureAt: now.Add(-16 * time.Minute)}, 0},
+		{"locked out", models.LoginThrottle{Failures: 10, LastFailureAt: now, LockedUntil: &locked}, 5 * time.Minute},
+		{"lockout expired", models.LoginThrottle{Failures: 2, LastFailureAt: now.Add(-time.Hour), LockedUntil: &now}, 0},
+	}
+	for _, tt := range tests {
+		if got := l.waitFor(tt.row, policy, now); got != tt.want {
+			t.Errorf("%s: waitFor = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
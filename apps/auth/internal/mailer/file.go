@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into a directory,
+// where tests and developers can pick it up.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a FileMailer, creating dir if needed.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file mailer requires a directory")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes msg to <dir>/<unix nanos>.eml.
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	path := filepath.Join(m.dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+	return os.WriteFile(path, msg.encode(m.from), 0o600)
+}
+
+// LogMailer logs messages instead of sending them. Development only:
+// the log then contains the verification and reset links.
+type LogMailer struct{}
+
+// NewLogMailer creates a LogMailer.
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs msg.
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.Info("Email (log mailer)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Package mailer sends the auth service's transactional emails (verification,
+// password reset). Backends: SMTP for real delivery (or a local stand-in such as
+// Mailpit), and file/log backends for development and tests.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures a Mailer.
+type Config struct {
+	Backend string // smtp, file or log
+	From    string
+
+	// SMTP
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string // Empty: no authentication
+	SMTPPassword string
+
+	// File
+	Dir string
+}
+
+// New creates the Mailer selected by cfg.Backend.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Backend {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP mailer requires a host")
+		}
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case "log", "":
+		return NewLogMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q (want smtp, file or log)", cfg.Backend)
+	}
+}
+
+// encode renders msg as an RFC 5322 message.
+func (msg Message) encode(from string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// headerValue strips line breaks so values cannot inject headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -37,7 +37,7 @@ var (
 			Name: "auth_logins_total",
 			Help: "Total number of login attempts",
 		},
-		[]string{"status"}, // success, failure
+		[]string{"status"}, // success, failure, unverified, locked, mfa_required
 	)
 
 	TokenValidationsTotal = promauto.NewCounterVec(
@@ -48,7 +48,47 @@ var (
 		[]string{"status"}, // valid, invalid
 	)
 
+	TokenRefreshesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_token_refreshes_total",
+			Help: "Total number of refresh token exchanges",
+		},
+		[]string{"status"}, // success, invalid, reused
+	)
+
 	// Database metrics
+	APIKeyValidationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_api_key_validations_total",
+			Help: "Total number of API key validations",
+		},
+		[]string{"status"}, // valid, invalid
+	)
+
+	MFAVerificationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_mfa_verifications_total",
+			Help: "Total number of 2FA code verifications",
+		},
+		[]string{"method", "status"}, // method: totp, recovery; status: success, failure
+	)
+
+	LoginLockoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_login_lockouts_total",
+			Help: "Total number of login lockouts after too many failed attempts",
+		},
+		[]string{"scope"}, // account, ip
+	)
+
+	EmailsSentTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "auth_emails_sent_total",
+			Help: "Total number of emails sent",
+		},
+		[]string{"type", "status"}, // type: verify_email, password_reset; status: success, failure
+	)
+
 	DBQueryDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "auth_db_query_duration_seconds",
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize (e.g. by secret scanners).
+const APIKeyPrefix = "pfk_"
+
+// APIKey is a named, scoped credential for programmatic access on behalf of a user.
+// Only the SHA-256 of the key is stored; the key itself is shown once, at creation.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey"`
+	UserID     uint       `gorm:"index;not null"`
+	Name       string     `gorm:"not null"`
+	Prefix     string     `gorm:"not null"` // First characters of the key, to recognize it in listings
+	KeyHash    string     `gorm:"uniqueIndex;not null"`
+	Scopes     []string   `gorm:"serializer:json;not null"` // Limited further by the owner's current role scopes
+	ExpiresAt  *time.Time // Nil: never expires
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Email token purposes
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposePasswordReset = "password_reset"
+)
+
+// EmailToken is a single-use token sent by email to prove ownership of the address
+// (verification) or to set a new password (reset). Only its SHA-256 hash is stored.
+type EmailToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	Purpose   string     `gorm:"not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set when used, or when superseded by a newer token
+	CreatedAt time.Time
+}
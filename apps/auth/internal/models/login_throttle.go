@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one account (by email) or one
+// client IP. Keys look like "account:user@example.com" or "ip:203.0.113.7".
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey"`
+	Failures      int        `gorm:"not null"`       // Consecutive failures within the failure window
+	LastFailureAt time.Time  `gorm:"index;not null"` // Failures older than the window are forgotten
+	LockedUntil   *time.Time // Set once Failures reaches the limit
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the user has lost
+// their authenticator. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	CodeHash  string     `gorm:"not null"`
+	UsedAt    *time.Time // Set once used
+	CreatedAt time.Time
+}
+
+// MFAChallenge is issued by /login when the password is correct but 2FA is enabled.
+// Exchanging its token together with a valid code at /login/2fa starts the session.
+type MFAChallenge struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"` // SHA-256 of the challenge token
+	Attempts  int        `gorm:"not null;default:0"`   // Wrong codes entered so far
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once exchanged for tokens
+	CreatedAt time.Time
+}
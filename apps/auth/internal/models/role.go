@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Scopes are the permissions carried in access tokens. A user's token holds the
+// union of the scopes of all their roles.
+const (
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeWebhooksRead  = "webhooks:read"
+	ScopeWebhooksWrite = "webhooks:write"
+	ScopeAdminTasks    = "admin:tasks" // List all users' tasks, requeue failed ones
+	ScopeAdminUsers    = "admin:users" // Manage users and their roles
+)
+
+// Built-in roles
+const (
+	RoleUser  = "user"  // Granted to every new account
+	RoleAdmin = "admin" // Operators
+)
+
+// DefaultRoles are created (or completed) at startup. Scopes added to these roles
+// in the database are kept; missing ones are added back.
+var DefaultRoles = map[string][]string{
+	RoleUser: {ScopeTasksRead, ScopeTasksWrite, ScopeWebhooksRead, ScopeWebhooksWrite},
+	RoleAdmin: {
+		ScopeTasksRead, ScopeTasksWrite, ScopeWebhooksRead, ScopeWebhooksWrite,
+		ScopeAdminTasks, ScopeAdminUsers,
+	},
+}
+
+// Permission is a single scope that can be granted through roles.
+type Permission struct {
+	ID    uint   `gorm:"primaryKey"`
+	Scope string `gorm:"uniqueIndex;not null"`
+}
+
+// Role is a named set of permissions assigned to users.
+type Role struct {
+	ID          uint         `gorm:"primaryKey"`
+	Name        string       `gorm:"uniqueIndex;not null"`
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Session is one login of a user on one client. Every access token carries its
+// session ID (the "sid" claim), so revoking the session invalidates all of its
+// access and refresh tokens at once.
+type Session struct {
+	ID        string `gorm:"primaryKey"` // Random hex ID
+	UserID    uint   `gorm:"index;not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RefreshToken is a single-use token that renews a session's access token.
+// Each refresh marks the presented token used and issues a new one (rotation);
+// presenting a used token again revokes the whole session (reuse detection).
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	SessionID string     `gorm:"index;not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"` // SHA-256 of the token; the token itself is never stored
+	ExpiresAt time.Time  `gorm:"index;not null"`
+	UsedAt    *time.Time // Set once the token has been exchanged
+	CreatedAt time.Time
+}
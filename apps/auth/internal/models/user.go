@@ -8,10 +8,15 @@ import (
 
 // User represents a registered user in the system.
 type User struct {
-	ID        uint           `gorm:"primaryKey"`
-	Email     string         `gorm:"uniqueIndex;not null"`
-	Password  string         `gorm:"not null"` // Hashed password
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
+	ID              uint       `gorm:"primaryKey"`
+	Email           string     `gorm:"uniqueIndex;not null"`
+	Password        string     `gorm:"not null"` // Hashed password
+	Roles           []Role     `gorm:"many2many:user_roles"`
+	EmailVerifiedAt *time.Time // Nil until the user follows the verification link
+	TOTPSecret      string     // Base32 TOTP secret; set at 2FA setup, active once TOTPEnabledAt is set
+	TOTPEnabledAt   *time.Time // Nil while 2FA is off
+	TOTPLastStep    int64      // Time step of the last accepted code, so codes cannot be replayed
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt `gorm:"index"`
 }
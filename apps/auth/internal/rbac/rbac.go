@@ -0,0 +1,122 @@
+// Package rbac stores roles and their scopes in Postgres and resolves the
+// roles and scopes embedded in a user's access tokens.
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownRole is returned when assigning a role that does not exist
+var ErrUnknownRole = errors.New("unknown role")
+
+// Seed creates the default roles and their permissions, and gives the user role
+// to accounts that have no role yet (e.g. created before roles existed).
+func Seed(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for name, scopes := range models.DefaultRoles {
+			role := models.Role{Name: name}
+			if err := tx.Where("name = ?", name).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			perms := make([]models.Permission, len(scopes))
+			for i, scope := range scopes {
+				perms[i] = models.Permission{Scope: scope}
+				if err := tx.Where("scope = ?", scope).FirstOrCreate(&perms[i]).Error; err != nil {
+					return err
+				}
+			}
+			// Append only adds missing links, so scopes granted by operators are kept
+			if err := tx.Model(&role).Association("Permissions").Append(perms); err != nil {
+				return err
+			}
+		}
+
+		// Backfill
+		return tx.Exec(`
+			INSERT INTO user_roles (user_id, role_id)
+			SELECT u.id, r.id FROM users u, roles r
+			WHERE r.name = ? AND NOT EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id)`,
+			models.RoleUser,
+		).Error
+	})
+}
+
+// Grants returns the names of the user's roles and the union of their scopes, sorted.
+func Grants(db *gorm.DB, userID uint) (roles, scopes []string, err error) {
+	var user models.User
+	if err := db.Preload("Roles.Permissions").First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+		for _, p := range role.Permissions {
+			if !seen[p.Scope] {
+				seen[p.Scope] = true
+				scopes = append(scopes, p.Scope)
+			}
+		}
+	}
+	sort.Strings(roles)
+	sort.Strings(scopes)
+	return roles, scopes, nil
+}
+
+// SetRoles replaces the user's roles with the named ones.
+func SetRoles(db *gorm.DB, user *models.User, names []string) error {
+	var roles []models.Role
+	if len(names) > 0 {
+		if err := db.Where("name IN ?", names).Find(&roles).Error; err != nil {
+			return err
+		}
+	}
+	if len(roles) != len(unique(names)) {
+		return fmt.Errorf("%w: %v", ErrUnknownRole, names)
+	}
+	return db.Model(user).Association("Roles").Replace(roles)
+}
+
+// GrantRole adds the named role to the user.
+func GrantRole(db *gorm.DB, user *models.User, name string) error {
+	var role models.Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrUnknownRole, name)
+		}
+		return err
+	}
+	return db.Model(user).Association("Roles").Append(&role)
+}
+
+// BootstrapAdmins grants the admin role to the existing accounts with the given emails.
+// Accounts registered later with one of these emails become admins at registration.
+func BootstrapAdmins(db *gorm.DB, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	var users []models.User
+	if err := db.Where("email IN ?", emails).Find(&users).Error; err != nil {
+		return err
+	}
+	for i := range users {
+		if err := GrantRole(db, &users[i], models.RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unique(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
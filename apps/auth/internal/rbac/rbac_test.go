@@ -0,0 +1,139 @@
+package rbac
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/sanjain/pixelflow/apps/auth/internal/dbtest"
+	"github.com/sanjain/pixelflow/apps/auth/internal/models"
+	"gorm.io/gorm"
+)
+
+// sorted returns a sorted copy of scopes.
+func sorted(scopes []string) []string {
+	s := slices.Clone(scopes)
+	sort.Strings(s)
+	return s
+}
+
+func createUser(t *testing.T, db *gorm.DB, email string) models.User {
+	t.Helper()
+	user := models.User{Email: email, Password: "unused"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestGrants(t *testing.T) {
+	db := dbtest.Open(t)
+	// Accounts that predate roles get the user role from Seed
+	user := createUser(t, db, "user@example.com")
+	if err := Seed(db); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		roles      []string
+		wantScopes []string
+		wantErr    error
+	}{
+		{"backfilled", nil, models.DefaultRoles[models.RoleUser], nil},
+		{"admin", []string{models.RoleAdmin}, models.DefaultRoles[models.RoleAdmin], nil},
+		{"both roles", []string{models.RoleUser, models.RoleAdmin}, models.DefaultRoles[models.RoleAdmin], nil},
+		{"no roles", []string{}, nil, nil},
+		{"unknown role", []string{models.RoleUser, "root"}, nil, ErrUnknownRole},
+	}
+	for _, tt := range tests {
+		if tt.roles != nil {
+			err := SetRoles(db, &user, tt.roles)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%s: SetRoles(%v) error = %v, want %v", tt.name, tt.roles, err, tt.wantErr)
+			}
+			if err != nil {
+				continue
+			}
+		}
+
+		roles, scopes, err := Grants(db, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.roles != nil && !slices.Equal(roles, sorted(tt.roles)) {
+			t.Errorf("%s: roles = %v, want %v", tt.name, roles, sorted(tt.roles))
+		}
+		if !slices.Equal(scopes, sorted(tt.wantScopes)) {
+			t.Errorf("%s: scopes = %v, want %v", tt.name, scopes, sorted(tt.wantScopes))
+		}
+	}
+}
+
+func TestSeedKeepsGrantedScopes(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := Seed(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// An operator grants an extra scope to the user role
+	var role models.Role
+	if err := db.Where("name = ?", models.RoleUser).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	extra := models.Permission{Scope: models.ScopeAdminTasks}
+	if err := db.Where("scope = ?", extra.Scope).First(&extra).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&role).Association("Permissions").Append(&extra); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seeding again (the next start) keeps it and does not duplicate anything
+	if err := Seed(db); err != nil {
+		t.Fatal(err)
+	}
+	user := createUser(t, db, "user@example.com")
+	if err := GrantRole(db, &user, models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	_, scopes, err := Grants(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sorted(append(slices.Clone(models.DefaultRoles[models.RoleUser]), models.ScopeAdminTasks))
+	if !slices.Equal(scopes, want) {
+		t.Fatalf("scopes = %v, want %v", scopes, want)
+	}
+
+	var roles int64
+	if err := db.Model(&models.Role{}).Count(&roles).Error; err != nil {
+		t.Fatal(err)
+	}
+	if roles != int64(len(models.DefaultRoles)) {
+		t.Fatalf("%d roles after seeding twice, want %d", roles, len(models.DefaultRoles))
+	}
+}
+
+func TestBootstrapAdmins(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := Seed(db); err != nil {
+		t.Fatal(err)
+	}
+	admin := createUser(t, db, "ops@example.com")
+	other := createUser(t, db, "user@example.com")
+
+	if err := BootstrapAdmins(db, []string{"ops@example.com", "missing@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if roles, _, _ := Grants(db, admin.ID); !slices.Contains(roles, models.RoleAdmin) {
+		t.Errorf("bootstrapped account roles = %v, want admin", roles)
+	}
+	if roles, _, _ := Grants(db, other.ID); slices.Contains(roles, models.RoleAdmin) {
+		t.Errorf("other account roles = %v, want no admin", roles)
+	}
+	if err := GrantRole(db, &other, "root"); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("GrantRole(root) error = %v, want ErrUnknownRole", err)
+	}
+}
@@ -1,14 +1,27 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/sanjain/pixelflow/apps/auth/internal/keys"
+	"github.com/sanjain/pixelflow/pkg/jwks"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var SecretKey = []byte("super-secret-key") // In production, use env var
+// Claims are the claims carried by access tokens.
+type Claims struct {
+	UserID    string   `json:"user_id"`
+	SessionID string   `json:"sid"`              // Session the token belongs to; checked for revocation by /validate
+	Roles     []string `json:"roles,omitempty"`  // Role names, informational
+	Scopes    []string `json:"scopes,omitempty"` // Permissions granted by the roles; checked by RequireScope
+	jwt.RegisteredClaims
+}
 
 // HashPassword hashes a plain text password.
 func HashPassword(password string) (string, error) {
@@ -22,34 +35,75 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateJWT generates a JWT token for a user.
-func GenerateJWT(userID string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // 24 hours
+// DummyPasswordHash is a bcrypt hash at the same cost as HashPassword. Login
+// compares against it when there is no account, so unknown emails take as
+// long as a wrong password.
+const DummyPasswordHash = "$2a$14$obQ3g2lsAMYOb1OZwrQBiuVcnHIC0vU1RUaigkrhThK0Z4gOJNaK2"
+
+// GenerateJWT generates a short-lived access token with the given user, session,
+// roles and scopes, signed with the current key of ks. The key ID is set in the "kid" header.
+func GenerateJWT(ks *keys.KeySet, claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(SecretKey)
+	key := ks.Signer()
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
-// ValidateJWT parses and validates a JWT token.
-func ValidateJWT(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// ValidateJWT parses and validates a JWT token against the keys of ks.
+// It only checks the signature and expiry; session revocation is checked by the caller.
+func ValidateJWT(ks *keys.KeySet, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.Lookup(kid)
+		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		// The algorithm is bound to the key, never taken from the token alone
+		if token.Method.Alg() != key.Alg {
 			return nil, errors.New("unexpected signing method")
 		}
-		return SecretKey, nil
-	})
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{jwks.AlgRS256, jwks.AlgEdDSA}))
 
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if !token.Valid || claims.UserID == "" || claims.SessionID == "" {
+		return nil, errors.New("invalid token")
 	}
+	return claims, nil
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := claims["user_id"].(string)
-		return userID, nil
+// NewOpaqueToken generates a random URL-safe token (e.g., a refresh token) and
+// the hash to store in its place.
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
 	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 of an opaque token.
+// Opaque tokens carry 256 bits of randomness, so an unsalted fast hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
 
-	return "", errors.New("invalid token")
+// NewID returns a random 128-bit hex identifier.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
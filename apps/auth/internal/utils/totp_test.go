@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of the RFC 6238 test vectors, base32 encoded.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 Appendix B (SHA-1), truncated to our 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, now)
+		if !ok || step != tt.unix/30 {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v, want %d, true", tt.code, tt.unix, step, ok, tt.unix/30)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0) // Step 37037037
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+
+	tests := []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		step := now.Unix()/30 + tt.offset
+		got, ok := ValidateTOTP(rfc6238Secret, totpCode(key, step), now)
+		if ok != tt.ok || (ok && got != step) {
+			t.Errorf("code of step %+d: ValidateTOTP = %d, %v, want ok %v", tt.offset, got, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	tests := []struct {
+		name, secret, code string
+	}{
+		{"wrong code", rfc6238Secret, "287083"},
+		{"8 digits", rfc6238Secret, "94287082"},
+		{"5 digits", rfc6238Secret, "28708"},
+		{"bad secret", "not base32!", "287082"},
+	}
+	for _, tt := range tests {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok {
+			t.Errorf("%s: ValidateTOTP(%q, %q) = true", tt.name, tt.secret, tt.code)
+		}
+	}
+
+	// Secrets are accepted in either case
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), "287082", now); !ok {
+		t.Error("lower case secret rejected")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	code, err := NewRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("NewRecoveryCode() = %q, want xxxxx-xxxxx", code)
+	}
+	want := NormalizeRecoveryCode(code)
+	for _, typed := range []string{code[:5] + code[6:], " " + code + " ", code[:5] + " " + code[6:], strings.ToUpper(code)} {
+		if got := NormalizeRecoveryCode(typed); got != want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", typed, got, want)
+		}
+	}
+}
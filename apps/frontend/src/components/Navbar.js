@@ -24,6 +24,12 @@ const Navbar = () => {
                         {user ? (
                             <div className="flex items-center space-x-4">
                                 <span className="text-gray-300 text-sm">{user.email}</span>
+                                <Link
+                                    to="/security"
+                                    className="text-gray-300 hover:bg-gray-700 hover:text-white px-3 py-2 rounded-md text-sm font-medium transition-colors"
+                                >
+                                    Security
+                                </Link>
                                 <button
                                     onClick={handleLogout}
                                     className="bg-red-600 hover:bg-red-700 text-white px-3 py-2 rounded-md text-sm font-medium transition-colors"
@@ -1,6 +1,6 @@
 import React from 'react';
 
-const TaskList = ({ tasks, loading }) => {
+const TaskList = ({ tasks, loading, onCancel, onDelete }) => {
     if (loading) {
         return <div className="text-center py-4">Loading tasks...</div>;
     }
@@ -14,6 +14,7 @@ const TaskList = ({ tasks, loading }) => {
             case 'COMPLETED': return 'bg-green-100 text-green-800';
             case 'PROCESSING': return 'bg-blue-100 text-blue-800';
             case 'FAILED': return 'bg-red-100 text-red-800';
+            case 'CANCELLED': return 'bg-gray-100 text-gray-800';
             default: return 'bg-yellow-100 text-yellow-800';
         }
     };
@@ -32,6 +33,15 @@ const TaskList = ({ tasks, loading }) => {
                                     <span className={`px-2 inline-flex text-xs leading-5 font-semibold rounded-full ${getStatusColor(task.status)}`}>
                                         {task.status}
                                     </span>
+                                    {(task.status === 'PENDING' || task.status === 'PROCESSING') ? (
+                                        <button onClick={() => onCancel(task._id)} className="ml-2 text-xs text-gray-600 hover:text-gray-900">
+                                            Cancel
+                                        </button>
+                                    ) : (
+                                        <button onClick={() => onDelete(task._id)} className="ml-2 text-xs text-red-600 hover:text-red-800">
+                                            Delete
+                                        </button>
+                                    )}
                                 </div>
                             </div>
                             <div className="mt-2 sm:flex sm:justify-between">
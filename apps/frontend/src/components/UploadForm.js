@@ -1,11 +1,19 @@
-import React, { useState } from 'react';
+import React, { useRef, useState } from 'react';
 import { taskService } from '../services/api';
 
+// crypto.randomUUID only exists in secure contexts (HTTPS or localhost)
+const newIdempotencyKey = () => (window.crypto?.randomUUID
+    ? window.crypto.randomUUID()
+    : `${Date.now()}-${Math.random().toString(36).slice(2)}`);
+
 const UploadForm = ({ onTaskCreated }) => {
     const [imageUrl, setImageUrl] = useState('');
+    const [file, setFile] = useState(null);
     const [loading, setLoading] = useState(false);
     const [error, setError] = useState('');
     const [success, setSuccess] = useState('');
+    // One key per task: resubmitting after a failure or timeout cannot create a duplicate
+    const idempotencyKey = useRef(null);
 
     const handleSubmit = async (e) => {
         e.preventDefault();
@@ -14,12 +22,23 @@ const UploadForm = ({ onTaskCreated }) => {
         setSuccess('');
 
         try {
-            await taskService.upload(imageUrl);
+            if (file) {
+                await taskService.uploadFile(file);
+            } else {
+                if (!idempotencyKey.current) idempotencyKey.current = newIdempotencyKey();
+                await taskService.upload(imageUrl, idempotencyKey.current);
+            }
+            idempotencyKey.current = null;
             setSuccess('Task created successfully!');
             setImageUrl('');
+            setFile(null);
+            e.target.reset();
             if (onTaskCreated) onTaskCreated();
         } catch (err) {
-            setError('Failed to create task. Please try again.');
+            // 429: rate limit or quota; the API explains which
+            setError(err.response?.status === 429
+                ? `${err.response.data?.error}. Try again in ${err.response.headers['retry-after']}s.`
+                : 'Failed to create task. Please try again.');
         } finally {
             setLoading(false);
         }
@@ -49,8 +68,11 @@ const UploadForm = ({ onTaskCreated }) => {
                             className="flex-1 focus:ring-indigo-500 focus:border-indigo-500 block w-full min-w-0 rounded-md sm:text-sm border-gray-300 p-2 border"
                             placeholder="https://example.com/image.jpg"
                             value={imageUrl}
-                            onChange={(e) => setImageUrl(e.target.value)}
-                            required
+                            onChange={(e) => {
+                                setImageUrl(e.target.value);
+                                idempotencyKey.current = null;
+                            }}
+                            required={!file}
                         />
                         <button
                             type="submit"
@@ -61,6 +83,19 @@ const UploadForm = ({ onTaskCreated }) => {
                         </button>
                     </div>
                 </div>
+                <div>
+                    <label htmlFor="file" className="block text-sm font-medium text-gray-700">
+                        Or upload a file (JPEG, PNG, GIF)
+                    </label>
+                    <input
+                        type="file"
+                        name="file"
+                        id="file"
+                        accept="image/jpeg,image/png,image/gif"
+                        className="mt-1 block w-full text-sm text-gray-700"
+                        onChange={(e) => setFile(e.target.files[0] || null)}
+                    />
+                </div>
             </form>
         </div>
     );
@@ -18,8 +18,17 @@ export const AuthProvider = ({ children }) => {
                     // For simplicity, we'll just set a dummy user object since validate returns ID
                     setUser({ token });
                 } catch (error) {
-                    console.error('Invalid token', error);
-                    localStorage.removeItem('token');
+                    // The access token is short-lived; try to renew it before giving up
+                    try {
+                        const data = await authService.refresh(localStorage.getItem('refresh_token'));
+                        localStorage.setItem('token', data.token);
+                        localStorage.setItem('refresh_token', data.refresh_token);
+                        setUser({ token: data.token });
+                    } catch (refreshError) {
+                        console.error('Invalid token', error);
+                        localStorage.removeItem('token');
+                        localStorage.removeItem('refresh_token');
+                    }
                 }
             }
             setLoading(false);
@@ -27,10 +36,24 @@ export const AuthProvider = ({ children }) => {
         initAuth();
     }, []);
 
-    const login = async (email, password) => {
-        const data = await authService.login(email, password);
+    const startSession = (data, email) => {
         localStorage.setItem('token', data.token);
+        localStorage.setItem('refresh_token', data.refresh_token);
         setUser({ token: data.token, email });
+    };
+
+    // Resolves with mfa_required and a challenge_token instead of logging in when 2FA is on
+    const login = async (email, password) => {
+        const data = await authService.login(email, password);
+        if (!data.mfa_required) {
+            startSession(data, email);
+        }
+        return data;
+    };
+
+    const loginMFA = async (email, challengeToken, code) => {
+        const data = await authService.loginMFA(challengeToken, code);
+        startSession(data, email);
         return data;
     };
 
@@ -38,13 +61,23 @@ export const AuthProvider = ({ children }) => {
         return await authService.register(email, password);
     };
 
-    const logout = () => {
+    const logout = async () => {
+        // Revoke the session server-side so the tokens cannot be reused
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (refreshToken) {
+            try {
+                await authService.logout(refreshToken);
+            } catch (error) {
+                console.error('Failed to revoke session', error);
+            }
+        }
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         setUser(null);
     };
 
     return (
-        <AuthContext.Provider value={{ user, login, register, logout, loading }}>
+        <AuthContext.Provider value={{ user, login, loginMFA, register, logout, loading }}>
             {!loading && children}
         </AuthContext.Provider>
     );
@@ -18,11 +18,56 @@ const Dashboard = () => {
         }
     };
 
+    const handleCancel = async (id) => {
+        try {
+            await taskService.cancel(id);
+        } catch (error) {
+            console.error('Failed to cancel task', error);
+        }
+        fetchTasks();
+    };
+
+    const handleDelete = async (id) => {
+        try {
+            await taskService.remove(id);
+        } catch (error) {
+            console.error('Failed to delete task', error);
+        }
+        fetchTasks();
+    };
+
+    // Insert a new task or replace the existing copy
+    const mergeTask = (task) => {
+        setTasks((prev) => {
+            const i = prev.findIndex((t) => t._id === task._id);
+            if (i === -1) return [task, ...prev];
+            const next = [...prev];
+            next[i] = task;
+            return next;
+        });
+    };
+
     useEffect(() => {
         fetchTasks();
-        // Poll for updates every 3 seconds
-        const interval = setInterval(fetchTasks, 3000);
-        return () => clearInterval(interval);
+
+        // Receive status changes as they happen instead of polling.
+        // If the stream ends, reload the list (updates may have been missed) and reconnect.
+        let stopStream = () => {};
+        let retry;
+        const connect = () => {
+            stopStream = taskService.stream(mergeTask, () => {
+                retry = setTimeout(() => {
+                    fetchTasks();
+                    connect();
+                }, 3000);
+            });
+        };
+        connect();
+
+        return () => {
+            clearTimeout(retry);
+            stopStream();
+        };
     }, []);
 
     return (
@@ -36,7 +81,7 @@ const Dashboard = () => {
                     <h3 className="text-lg leading-6 font-medium text-gray-900 mb-4">
                         Your Tasks
                     </h3>
-                    <TaskList tasks={tasks} loading={loading} />
+                    <TaskList tasks={tasks} loading={loading} onCancel={handleCancel} onDelete={handleDelete} />
                 </div>
             </div>
         </div>
@@ -1,30 +1,74 @@
 import React, { useState } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
+import { authService } from '../services/api';
 
 const Login = () => {
     const [email, setEmail] = useState('');
     const [password, setPassword] = useState('');
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
-    const { login } = useAuth();
+    const [unverified, setUnverified] = useState(false);
+    const [notice, setNotice] = useState('');
+    const [challenge, setChallenge] = useState(null);
+    const [code, setCode] = useState('');
+    const { login, loginMFA } = useAuth();
     const navigate = useNavigate();
 
     const handleSubmit = async (e) => {
         e.preventDefault();
         setError('');
+        setNotice('');
+        setUnverified(false);
         setLoading(true);
 
         try {
-            await login(email, password);
-            navigate('/dashboard');
+            const data = await login(email, password);
+            if (data.mfa_required) {
+                setChallenge(data.challenge_token);
+            } else {
+                navigate('/dashboard');
+            }
         } catch (err) {
             setError(err.response?.data?.error || 'Failed to login');
+            setUnverified(err.response?.status === 403);
         } finally {
             setLoading(false);
         }
     };
 
+    const handleCode = async (e) => {
+        e.preventDefault();
+        setError('');
+        setLoading(true);
+
+        try {
+            await loginMFA(email, challenge, code.trim());
+            navigate('/dashboard');
+        } catch (err) {
+            // An expired or exhausted challenge means starting over with the password
+            if (err.response?.data?.error?.includes('challenge')) {
+                setChallenge(null);
+                setPassword('');
+            }
+            setCode('');
+            setError(err.response?.data?.error || 'Failed to verify code');
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    const handleResend = async () => {
+        try {
+            await authService.resendVerification(email);
+            setError('');
+            setUnverified(false);
+            setNotice('Verification email sent. Check your inbox.');
+        } catch (err) {
+            setError(err.response?.data?.error || 'Failed to resend verification email');
+        }
+    };
+
     return (
         <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
             <div className="max-w-md w-full space-y-8 bg-white p-8 rounded-xl shadow-md">
@@ -39,46 +83,93 @@ const Login = () => {
                         </Link>
                     </p>
                 </div>
-                <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
-                    {error && (
-                        <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded relative" role="alert">
-                            <span className="block sm:inline">{error}</span>
-                        </div>
-                    )}
-                    <div className="rounded-md shadow-sm -space-y-px">
-                        <div>
-                            <input
-                                type="email"
-                                required
-                                className="appearance-none rounded-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-t-md focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 focus:z-10 sm:text-sm"
-                                placeholder="Email address"
-                                value={email}
-                                onChange={(e) => setEmail(e.target.value)}
-                            />
-                        </div>
-                        <div>
-                            <input
-                                type="password"
-                                required
-                                className="appearance-none rounded-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-b-md focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 focus:z-10 sm:text-sm"
-                                placeholder="Password"
-                                value={password}
-                                onChange={(e) => setPassword(e.target.value)}
-                            />
-                        </div>
-                    </div>
-
-                    <div>
+                {challenge ? (
+                    <form className="mt-8 space-y-6" onSubmit={handleCode}>
+                        {error && (
+                            <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded relative" role="alert">
+                                <span className="block sm:inline">{error}</span>
+                            </div>
+                        )}
+                        <p className="text-sm text-gray-600">
+                            Enter the 6-digit code from your authenticator app, or one of your recovery codes.
+                        </p>
+                        <input
+                            type="text"
+                            required
+                            autoFocus
+                            autoComplete="one-time-code"
+                            className="appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 sm:text-sm"
+                            placeholder="Authentication code"
+                            value={code}
+                            onChange={(e) => setCode(e.target.value)}
+                        />
                         <button
                             type="submit"
                             disabled={loading}
                             className={`group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 ${loading ? 'opacity-50 cursor-not-allowed' : ''
                                 }`}
                         >
-                            {loading ? 'Signing in...' : 'Sign in'}
+                            {loading ? 'Verifying...' : 'Verify'}
                         </button>
-                    </div>
-                </form>
+                    </form>
+                ) : (
+                    <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+                        {error && (
+                            <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded relative" role="alert">
+                                <span className="block sm:inline">{error}</span>
+                                {unverified && (
+                                    <button type="button" onClick={handleResend} className="ml-2 font-medium underline">
+                                        Resend verification email
+                                    </button>
+                                )}
+                            </div>
+                        )}
+                        {notice && (
+                            <div className="bg-green-100 border border-green-400 text-green-700 px-4 py-3 rounded relative" role="status">
+                                <span className="block sm:inline">{notice}</span>
+                            </div>
+                        )}
+                        <div className="rounded-md shadow-sm -space-y-px">
+                            <div>
+                                <input
+                                    type="email"
+                                    required
+                                    className="appearance-none rounded-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-t-md focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 focus:z-10 sm:text-sm"
+                                    placeholder="Email address"
+                                    value={email}
+                                    onChange={(e) => setEmail(e.target.value)}
+                                />
+                            </div>
+                            <div>
+                                <input
+                                    type="password"
+                                    required
+                                    className="appearance-none rounded-none relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 rounded-b-md focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 focus:z-10 sm:text-sm"
+                                    placeholder="Password"
+                                    value={password}
+                                    onChange={(e) => setPassword(e.target.value)}
+                                />
+                            </div>
+                        </div>
+
+                        <div className="text-sm text-right">
+                            <Link to="/forgot-password" className="font-medium text-indigo-600 hover:text-indigo-500">
+                                Forgot your password?
+                            </Link>
+                        </div>
+
+                        <div>
+                            <button
+                                type="submit"
+                                disabled={loading}
+                                className={`group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 ${loading ? 'opacity-50 cursor-not-allowed' : ''
+                                    }`}
+                            >
+                                {loading ? 'Signing in...' : 'Sign in'}
+                            </button>
+                        </div>
+                    </form>
+                )}
             </div>
         </div>
     );
@@ -1,5 +1,5 @@
 import React, { useState } from 'react';
-import { Link, useNavigate } from 'react-router-dom';
+import { Link } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
 
 const Register = () => {
@@ -8,8 +8,8 @@ const Register = () => {
     const [confirmPassword, setConfirmPassword] = useState('');
     const [error, setError] = useState('');
     const [loading, setLoading] = useState(false);
-    const { register, login } = useAuth();
-    const navigate = useNavigate();
+    const [registered, setRegistered] = useState(false);
+    const { register } = useAuth();
 
     const handleSubmit = async (e) => {
         e.preventDefault();
@@ -23,9 +23,8 @@ const Register = () => {
 
         try {
             await register(email, password);
-            // Auto login after register
-            await login(email, password);
-            navigate('/dashboard');
+            // The account must be verified from the emailed link before signing in
+            setRegistered(true);
         } catch (err) {
             setError(err.response?.data?.error || 'Failed to create an account');
         } finally {
@@ -33,6 +32,23 @@ const Register = () => {
         }
     };
 
+    if (registered) {
+        return (
+            <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+                <div className="max-w-md w-full space-y-4 bg-white p-8 rounded-xl shadow-md text-center">
+                    <h2 className="text-2xl font-extrabold text-gray-900">Check your email</h2>
+                    <p className="text-sm text-gray-600">
+                        We sent a verification link to <span className="font-medium">{email}</span>.
+                        Open it to activate your account, then sign in.
+                    </p>
+                    <Link to="/login" className="font-medium text-indigo-600 hover:text-indigo-500">
+                        Go to sign in
+                    </Link>
+                </div>
+            </div>
+        );
+    }
+
     return (
         <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
             <div className="max-w-md w-full space-y-8 bg-white p-8 rounded-xl shadow-md">
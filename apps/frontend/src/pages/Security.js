@@ -0,0 +1,161 @@
+import React, { useEffect, useState } from 'react';
+import { mfaService } from '../services/api';
+
+const inputClass = 'appearance-none rounded-md relative block w-full px-3 py-2 border border-gray-300 placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-indigo-500 focus:border-indigo-500 sm:text-sm';
+const buttonClass = 'py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-indigo-600 hover:bg-indigo-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500';
+
+const RecoveryCodes = ({ codes }) => (
+    <div className="bg-yellow-50 border border-yellow-300 rounded p-4">
+        <p className="text-sm text-gray-700 mb-2">
+            Save these recovery codes somewhere safe. Each works once if you lose your authenticator; they are not shown again.
+        </p>
+        <ul className="grid grid-cols-2 gap-1 font-mono text-sm">
+            {codes.map((c) => <li key={c}>{c}</li>)}
+        </ul>
+    </div>
+);
+
+const Security = () => {
+    const [status, setStatus] = useState(null);
+    const [setup, setSetup] = useState(null);
+    const [recoveryCodes, setRecoveryCodes] = useState(null);
+    const [code, setCode] = useState('');
+    const [password, setPassword] = useState('');
+    const [error, setError] = useState('');
+
+    const loadStatus = async () => {
+        try {
+            setStatus(await mfaService.status());
+        } catch (err) {
+            setError(err.response?.data?.error || 'Failed to load 2FA status');
+        }
+    };
+
+    useEffect(() => {
+        loadStatus();
+    }, []);
+
+    const run = async (action) => {
+        setError('');
+        try {
+            await action();
+            setCode('');
+            setPassword('');
+        } catch (err) {
+            setError(err.response?.data?.error || 'Request failed');
+        }
+    };
+
+    const handleSetup = () => run(async () => {
+        setRecoveryCodes(null);
+        setSetup(await mfaService.setup());
+    });
+
+    const handleEnable = (e) => {
+        e.preventDefault();
+        run(async () => {
+            const data = await mfaService.enable(code.trim());
+            setSetup(null);
+            setRecoveryCodes(data.recovery_codes);
+            await loadStatus();
+        });
+    };
+
+    const handleDisable = (e) => {
+        e.preventDefault();
+        run(async () => {
+            await mfaService.disable(password, code.trim());
+            setRecoveryCodes(null);
+            await loadStatus();
+        });
+    };
+
+    const handleRegenerate = () => run(async () => {
+        const data = await mfaService.regenerateRecoveryCodes(code.trim());
+        setRecoveryCodes(data.recovery_codes);
+        await loadStatus();
+    });
+
+    return (
+        <div className="max-w-2xl mx-auto py-8 px-4 space-y-6">
+            <h1 className="text-2xl font-bold text-gray-900">Two-factor authentication</h1>
+
+            {error && (
+                <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded relative" role="alert">
+                    <span className="block sm:inline">{error}</span>
+                </div>
+            )}
+
+            {recoveryCodes && <RecoveryCodes codes={recoveryCodes} />}
+
+            {status && !status.enabled && (
+                <div className="bg-white p-6 rounded-xl shadow-md space-y-4">
+                    <p className="text-sm text-gray-600">
+                        2FA is off. When it is on, signing in also asks for a code from an authenticator app.
+                    </p>
+                    {!setup ? (
+                        <button onClick={handleSetup} className={buttonClass}>Set up 2FA</button>
+                    ) : (
+                        <form onSubmit={handleEnable} className="space-y-4">
+                            <p className="text-sm text-gray-600">
+                                Add this account to your authenticator app with the link below (or enter the secret by hand), then type the code it shows.
+                            </p>
+                            <a href={setup.otpauth_uri} className="block break-all text-sm text-indigo-600">{setup.otpauth_uri}</a>
+                            <p className="font-mono text-sm break-all">{setup.secret}</p>
+                            <input
+                                type="text"
+                                required
+                                autoComplete="one-time-code"
+                                className={inputClass}
+                                placeholder="6-digit code"
+                                value={code}
+                                onChange={(e) => setCode(e.target.value)}
+                            />
+                            <button type="submit" className={buttonClass}>Enable 2FA</button>
+                        </form>
+                    )}
+                </div>
+            )}
+
+            {status && status.enabled && (
+                <div className="bg-white p-6 rounded-xl shadow-md space-y-4">
+                    <p className="text-sm text-gray-600">
+                        2FA is on. {status.recovery_codes_remaining} recovery codes left.
+                    </p>
+                    <form onSubmit={handleDisable} className="space-y-4">
+                        <input
+                            type="text"
+                            required
+                            autoComplete="one-time-code"
+                            className={inputClass}
+                            placeholder="Authentication code"
+                            value={code}
+                            onChange={(e) => setCode(e.target.value)}
+                        />
+                        <input
+                            type="password"
+                            className={inputClass}
+                            placeholder="Password (to turn 2FA off)"
+                            value={password}
+                            onChange={(e) => setPassword(e.target.value)}
+                        />
+                        <div className="flex space-x-4">
+                            <button type="button" onClick={handleRegenerate} className={buttonClass}>
+                                New recovery codes
+                            </button>
+                            <button
+                                type="submit"
+                                disabled={!password}
+                                className="py-2 px-4 text-sm font-medium rounded-md text-white bg-red-600 hover:bg-red-700 disabled:opacity-50"
+                            >
+                                Turn off 2FA
+                            </button>
+                        </div>
+                    </form>
+                </div>
+            )}
+        </div>
+    );
+};
+
+export default Security;
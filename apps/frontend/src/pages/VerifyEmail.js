@@ -0,0 +1,59 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { authService } from '../services/api';
+
+const VerifyEmail = () => {
+    const [searchParams] = useSearchParams();
+    const [status, setStatus] = useState('verifying');
+    const [error, setError] = useState('');
+    const started = useRef(false);
+
+    useEffect(() => {
+        // Tokens are single use; make sure StrictMode's double effect does not spend it twice
+        if (started.current) return;
+        started.current = true;
+
+        const token = searchParams.get('token');
+        if (!token) {
+            setStatus('error');
+            setError('Missing verification token');
+            return;
+        }
+        authService.verifyEmail(token)
+            .then(() => setStatus('verified'))
+            .catch((err) => {
+                setStatus('error');
+                setError(err.response?.data?.error || 'Failed to verify email');
+            });
+    }, [searchParams]);
+
+    return (
+        <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+            <div className="max-w-md w-full space-y-4 bg-white p-8 rounded-xl shadow-md text-center">
+                {status === 'verifying' && (
+                    <p className="text-sm text-gray-600">Verifying your email...</p>
+                )}
+                {status === 'verified' && (
+                    <>
+                        <h2 className="text-2xl font-extrabold text-gray-900">Email verified</h2>
+                        <p className="text-sm text-gray-600">Your account is ready.</p>
+                    </>
+                )}
+                {status === 'error' && (
+                    <>
+                        <h2 className="text-2xl font-extrabold text-gray-900">Verification failed</h2>
+                        <p className="text-sm text-red-700">{error}</p>
+                        <p className="text-sm text-gray-600">Sign in to request a new verification email.</p>
+                    </>
+                )}
+                {status !== 'verifying' && (
+                    <Link to="/login" className="font-medium text-indigo-600 hover:text-indigo-500">
+                        Go to sign in
+                    </Link>
+                )}
+            </div>
+        </div>
+    );
+};
+
+export default VerifyEmail;
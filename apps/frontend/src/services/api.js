@@ -20,15 +20,72 @@ api.interceptors.request.use(
     (error) => Promise.reject(error)
 );
 
+// On 401, exchange the refresh token for a new access token once and retry the request.
+// Concurrent failures share a single refresh, since refresh tokens are single use.
+let refreshing = null;
+api.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+        const original = error.config;
+        const refreshToken = localStorage.getItem('refresh_token');
+        if (error.response?.status !== 401 || original._retried || !refreshToken) {
+            return Promise.reject(error);
+        }
+        original._retried = true;
+
+        try {
+            refreshing = refreshing || authService.refresh(refreshToken);
+            const data = await refreshing;
+            localStorage.setItem('token', data.token);
+            localStorage.setItem('refresh_token', data.refresh_token);
+        } catch (refreshError) {
+            localStorage.removeItem('token');
+            localStorage.removeItem('refresh_token');
+            return Promise.reject(error);
+        } finally {
+            refreshing = null;
+        }
+        return api(original);
+    }
+);
+
 export const authService = {
     login: async (email, password) => {
         const response = await axios.post(`${AUTH_URL}/login`, { email, password });
         return response.data;
     },
+    // Second login step when /login answered mfa_required
+    loginMFA: async (challengeToken, code) => {
+        const response = await axios.post(`${AUTH_URL}/login/2fa`, { challenge_token: challengeToken, code });
+        return response.data;
+    },
     register: async (email, password) => {
         const response = await axios.post(`${AUTH_URL}/register`, { email, password });
         return response.data;
     },
+    refresh: async (refreshToken) => {
+        const response = await axios.post(`${AUTH_URL}/refresh`, { refresh_token: refreshToken });
+        return response.data;
+    },
+    logout: async (refreshToken) => {
+        await axios.post(`${AUTH_URL}/logout`, { refresh_token: refreshToken });
+    },
+    verifyEmail: async (token) => {
+        const response = await axios.post(`${AUTH_URL}/verify-email`, { token });
+        return response.data;
+    },
+    resendVerification: async (email) => {
+        const response = await axios.post(`${AUTH_URL}/verify-email/resend`, { email });
+        return response.data;
+    },
+    forgotPassword: async (email) => {
+        const response = await axios.post(`${AUTH_URL}/password/forgot`, { email });
+        return response.data;
+    },
+    resetPassword: async (token, password) => {
+        const response = await axios.post(`${AUTH_URL}/password/reset`, { token, password });
+        return response.data;
+    },
     validate: async (token) => {
         const response = await axios.get(`${AUTH_URL}/validate`, {
             headers: { Authorization: `Bearer ${token}` }
@@ -37,14 +94,102 @@ export const authService = {
     }
 };
 
+// 2FA management on the Auth Service, with the user's access token
+const authHeaders = () => ({ headers: { Authorization: `Bearer ${localStorage.getItem('token')}` } });
+
+export const mfaService = {
+    status: async () => {
+        const response = await axios.get(`${AUTH_URL}/2fa`, authHeaders());
+        return response.data;
+    },
+    // Returns { secret, otpauth_uri } for the authenticator app
+    setup: async () => {
+        const response = await axios.post(`${AUTH_URL}/2fa/setup`, {}, authHeaders());
+        return response.data;
+    },
+    // Returns { recovery_codes }, shown only once
+    enable: async (code) => {
+        const response = await axios.post(`${AUTH_URL}/2fa/enable`, { code }, authHeaders());
+        return response.data;
+    },
+    disable: async (password, code) => {
+        await axios.post(`${AUTH_URL}/2fa/disable`, { password, code }, authHeaders());
+    },
+    regenerateRecoveryCodes: async (code) => {
+        const response = await axios.post(`${AUTH_URL}/2fa/recovery-codes`, { code }, authHeaders());
+        return response.data;
+    }
+};
+
 export const taskService = {
-    upload: async (imageUrl) => {
-        const response = await api.post('/api/upload', { image_url: imageUrl });
+    // Retrying with the same idempotencyKey returns the original task instead of a duplicate
+    upload: async (imageUrl, idempotencyKey) => {
+        const headers = idempotencyKey ? { 'Idempotency-Key': idempotencyKey } : {};
+        const response = await api.post('/api/upload', { image_url: imageUrl }, { headers });
+        return response.data;
+    },
+    uploadFile: async (file) => {
+        const form = new FormData();
+        form.append('file', file);
+        const response = await api.post('/api/upload/file', form);
+        return response.data;
+    },
+    // Returns the newest page of tasks; pass next_cursor back as `cursor` for the next one
+    getAll: async (params = {}) => {
+        const response = await api.get('/api/tasks', { params });
+        return response.data.tasks;
+    },
+    get: async (id) => {
+        const response = await api.get(`/api/tasks/${id}`);
         return response.data;
     },
-    getAll: async () => {
-        const response = await api.get('/api/tasks');
+    cancel: async (id) => {
+        const response = await api.post(`/api/tasks/${id}/cancel`);
         return response.data;
+    },
+    remove: async (id) => {
+        await api.delete(`/api/tasks/${id}`);
+    },
+    // Streams task changes (Server-Sent Events) to onTask until the returned function is called.
+    // onEnd is called if the server closes the stream; reconnect and reload tasks then.
+    // fetch is used instead of EventSource because EventSource cannot send the Authorization header.
+    stream: (onTask, onEnd) => {
+        const controller = new AbortController();
+        (async () => {
+            try {
+                const response = await fetch(`${API_URL}/api/tasks/stream`, {
+                    headers: { Authorization: `Bearer ${localStorage.getItem('token')}` },
+                    signal: controller.signal,
+                });
+                if (!response.ok) {
+                    throw new Error(`Task stream failed with status ${response.status}`);
+                }
+
+                const reader = response.body.getReader();
+                const decoder = new TextDecoder();
+                let buffer = '';
+                for (;;) {
+                    const { value, done } = await reader.read();
+                    if (done) break;
+                    buffer += decoder.decode(value, { stream: true });
+
+                    // Events are separated by a blank line; heartbeat comments carry no data
+                    let end;
+                    while ((end = buffer.indexOf('\n\n')) >= 0) {
+                        const data = buffer.slice(0, end).split('\n')
+                            .filter((line) => line.startsWith('data:'))
+                            .map((line) => line.slice(5))
+                            .join('\n');
+                        buffer = buffer.slice(end + 2);
+                        if (data) onTask(JSON.parse(data));
+                    }
+                }
+            } catch (error) {
+                if (!controller.signal.aborted) console.error('Task stream error', error);
+            }
+            if (!controller.signal.aborted && onEnd) onEnd();
+        })();
+        return () => controller.abort();
     }
 };
 
@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sanjain/pixelflow/apps/worker/internal/db"
 	"github.com/sanjain/pixelflow/apps/worker/internal/kafka"
 	"github.com/sanjain/pixelflow/apps/worker/internal/metrics"
+	"github.com/sanjain/pixelflow/apps/worker/internal/models"
 	"github.com/sanjain/pixelflow/apps/worker/internal/processor"
 	"github.com/sanjain/pixelflow/apps/worker/internal/tracing"
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/sanjain/pixelflow/pkg/outbox"
+	"github.com/sanjain/pixelflow/pkg/storage"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 )
@@ -25,6 +33,15 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// traceContext returns ctx carrying the trace context propagated in the message headers.
+func traceContext(ctx context.Context, event kafka.TaskEvent) context.Context {
+	carrier := propagation.MapCarrier{}
+	for _, h := range event.Headers {
+		carrier[h.Key] = string(h.Value)
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
 func main() {
 	// Initialize Structured Logger (JSON)
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
@@ -35,17 +52,60 @@ func main() {
 	defer shutdown(context.Background())
 
 	// Configuration
-	mongoURL := getEnv("MONGO_URL", "mongodb://localhost:27017")
+	mongoURL := getEnv("MONGO_URL", "mongodb://localhost:27017/?directConnection=true")
 	kafkaBrokers := strings.Split(getEnv("KAFKA_BROKERS", "localhost:9093"), ",")
 	metricsPort := getEnv("METRICS_PORT", "8081")
+	maxRetries, err := strconv.Atoi(getEnv("MAX_RETRIES", "3"))
+	if err != nil {
+		slog.Error("Invalid MAX_RETRIES", "error", err)
+		os.Exit(1)
+	}
+	retryBackoff, err := time.ParseDuration(getEnv("RETRY_BACKOFF", "1s"))
+	if err != nil {
+		slog.Error("Invalid RETRY_BACKOFF", "error", err)
+		os.Exit(1)
+	}
+	concurrency, err := strconv.Atoi(getEnv("WORKER_CONCURRENCY", "4"))
+	if err != nil || concurrency < 1 {
+		slog.Error("Invalid WORKER_CONCURRENCY", "value", getEnv("WORKER_CONCURRENCY", ""), "error", err)
+		os.Exit(1)
+	}
+	outboxInterval, err := time.ParseDuration(getEnv("OUTBOX_POLL_INTERVAL", "1s"))
+	if err != nil {
+		slog.Error("Invalid OUTBOX_POLL_INTERVAL", "error", err)
+		os.Exit(1)
+	}
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "30s"))
+	if err != nil {
+		slog.Error("Invalid SHUTDOWN_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+
+	// Only for local development: lets image URLs point at localhost and private networks
+	fetchAllowPrivate := getEnv("FETCH_ALLOW_PRIVATE_URLS", "false") == "true"
+
+	// Shutdown Handling
+	// ctx is cancelled on SIGINT/SIGTERM: the consumer stops fetching and drains.
+	// workCtx lives on until SHUTDOWN_TIMEOUT after the signal. In-flight tasks and the
+	// cleanup after them share that one deadline, so the whole shutdown fits in it;
+	// tasks still running at the deadline are aborted and redelivered to another worker.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	context.AfterFunc(ctx, func() {
+		slog.Info("Shutdown signal received, draining in-flight tasks", "timeout", shutdownTimeout.String())
+		time.AfterFunc(shutdownTimeout, cancelWork)
+	})
 
 	slog.Info("Starting Worker Service", "kafka_brokers", kafkaBrokers)
 
 	// 1. Start Metrics Server (Background)
+	http.Handle("/metrics", promhttp.Handler())
+	metricsServer := &http.Server{Addr: ":" + metricsPort}
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
 		slog.Info("Metrics server listening", "port", metricsPort)
-		if err := http.ListenAndServe(":"+metricsPort, nil); err != nil {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("Failed to start metrics server", "error", err)
 		}
 	}()
@@ -55,35 +115,65 @@ func main() {
 	dbHandler := db.Init(mongoURL, "pixelflow")
 	slog.Info("Connected to MongoDB")
 
-	// 3. Initialize Processor
-	proc := processor.NewProcessor(dbHandler.DB)
+	// 3. Initialize Object Storage
+	// Processed images are written here; the API serves/signs them for clients
+	storageCfg := storage.ConfigFromEnv()
+	blob, err := storage.New(context.Background(), storageCfg)
+	if err != nil {
+		slog.Error("Failed to initialize storage", "backend", storageCfg.Backend, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Object storage initialized", "backend", storageCfg.Backend)
+
+	// 4. Initialize Processor
+	// Every status change is written to the outbox with its lifecycle event, in one
+	// transaction; the relay publishes the events to "task-events" for downstream consumers.
+	// It is stopped only after the consumer has drained, so events of finished tasks still go out.
+	eventProducer := kafka.NewProducer(kafkaBrokers, events.TopicTaskEvents)
+	// The producer counts its own publishes and errors, so the relay needs no metric hooks
+	relay := outbox.NewRelay(outbox.New(dbHandler.DB, models.OutboxCollection), map[string]outbox.Publisher{
+		events.TopicTaskEvents: eventProducer,
+	}, outboxInterval, outbox.Hooks{})
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		relay.Run(relayCtx)
+		close(relayDone)
+	}()
+	proc := processor.NewProcessor(dbHandler.DB, blob, relay, fetchAllowPrivate)
 
-	// 4. Initialize Kafka Consumer
+	// 5. Initialize Kafka Consumer
 	// GroupID "worker-group-1" ensures we can scale workers horizontally
+	// Failed tasks are retried with exponential backoff, then moved to "image-tasks.dlq"
 	consumer := kafka.NewConsumer(
 		kafkaBrokers,
 		"image-tasks",
 		"worker-group-1",
+		concurrency,
+		kafka.RetryPolicy{
+			MaxRetries:     maxRetries,
+			InitialBackoff: retryBackoff,
+			MaxBackoff:     30 * time.Second,
+			Retryable: func(err error) bool {
+				return !errors.Is(err, processor.ErrPermanent)
+			},
+		},
 	)
-	defer consumer.Close()
-	slog.Info("Kafka Consumer initialized", "topic", "image-tasks", "group", "worker-group-1")
+	slog.Info("Kafka Consumer initialized", "topic", "image-tasks", "group", "worker-group-1", "concurrency", concurrency)
 
-	// 5. Start Consuming
-	// The handler function is called for each message
+	// 6. Start Consuming
+	// The handler function is called for each message, from up to WORKER_CONCURRENCY goroutines.
+	// Consume blocks until ctx is cancelled and in-flight tasks are finished or released.
 	slog.Info("Worker started consuming messages...")
-	consumer.Consume(context.Background(), func(event kafka.TaskEvent) error {
+	consumer.Consume(ctx, func(event kafka.TaskEvent) error {
 		slog.Info("Received task", "task_id", event.TaskID, "user_id", event.UserID)
 
 		// Extract Trace Context
-		carrier := propagation.MapCarrier{}
-		for _, h := range event.Headers {
-			carrier[h.Key] = string(h.Value)
-		}
-		ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+		taskCtx := traceContext(workCtx, event)
 
 		// Start Span
 		tracer := otel.Tracer("worker-service")
-		_, span := tracer.Start(ctx, "process_task")
+		taskCtx, span := tracer.Start(taskCtx, "process_task")
 		defer span.End()
 		
 		// Increment consumed metric
@@ -98,7 +188,7 @@ func main() {
 		start := time.Now()
 
 		// Process the image
-		err := proc.ProcessImage(event.TaskID)
+		err := proc.ProcessImage(taskCtx, event.TaskID)
 		
 		// Record processing duration
 		// We use a Histogram to calculate percentiles (P95, P99) later
@@ -116,5 +206,32 @@ func main() {
 		slog.Info("Task completed successfully", "task_id", event.TaskID)
 		metrics.TasksProcessedTotal.WithLabelValues("success").Inc()
 		return nil
+	}, func(event kafka.TaskEvent, reason error) {
+		// Retries are exhausted (or the error is permanent): record the reason on the task
+		if err := proc.MarkFailed(traceContext(workCtx, event), event.TaskID, reason); err != nil {
+			slog.Error("Failed to mark task as failed", "task_id", event.TaskID, "error", err)
+		}
 	})
+
+	// 7. Shut Down
+	// Offsets are committed by now; stop the relay, then close Kafka, Mongo and the metrics server.
+	// This uses what is left of the deadline set at the signal, not a fresh timeout.
+	shutdownCtx := workCtx
+
+	stopRelay()
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Outbox relay did not stop in time")
+	}
+
+	consumer.Close()
+	eventProducer.Close()
+	if err := dbHandler.Close(shutdownCtx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
+	}
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to stop metrics server", "error", err)
+	}
+	slog.Info("Worker Service stopped")
 }
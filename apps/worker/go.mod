@@ -27,6 +27,10 @@ require (
 	github.com/prometheus/client_model v0.6.2 // indirect
 	github.com/prometheus/common v0.66.1 // indirect
 	github.com/prometheus/procfs v0.16.1 // indirect
+	github.com/sanjain/pixelflow/pkg/events v0.0.0
+	github.com/sanjain/pixelflow/pkg/outbox v0.0.0
+	github.com/sanjain/pixelflow/pkg/safehttp v0.0.0
+	github.com/sanjain/pixelflow/pkg/storage v0.0.0
 	github.com/stretchr/testify v1.11.1 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
 	github.com/xdg-go/scram v1.1.2 // indirect
@@ -51,3 +55,11 @@ require (
 	google.golang.org/grpc v1.75.0 // indirect
 	google.golang.org/protobuf v1.36.8 // indirect
 )
+
+replace github.com/sanjain/pixelflow/pkg/storage => ../../pkg/storage
+
+replace github.com/sanjain/pixelflow/pkg/events => ../../pkg/events
+
+replace github.com/sanjain/pixelflow/pkg/outbox => ../../pkg/outbox
+
+replace github.com/sanjain/pixelflow/pkg/safehttp => ../../pkg/safehttp
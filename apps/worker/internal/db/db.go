@@ -2,9 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 
+	"github.com/sanjain/pixelflow/apps/worker/internal/models"
+	"github.com/sanjain/pixelflow/pkg/outbox"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -30,10 +34,48 @@ func Init(mongoURL, dbName string) *Handler {
 		log.Fatalf("MongoDB ping failed: %v", err)
 	}
 
+	// Status changes and their outbox messages are written in transactions, which need a replica set
+	if err := requireReplicaSet(ctx, client); err != nil {
+		log.Fatal(err)
+	}
+
+	db := client.Database(dbName)
+	if err := ensureIndexes(ctx, db); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+
 	fmt.Println("Connected to MongoDB")
 
 	return &Handler{
 		Client: client,
-		DB:     client.Database(dbName),
+		DB:     db,
 	}
 }
+
+// Close disconnects the MongoDB client, waiting for in-use connections until ctx expires.
+func (h *Handler) Close(ctx context.Context) error {
+	return h.Client.Disconnect(ctx)
+}
+
+// requireReplicaSet fails unless the server is a replica set member, since a
+// standalone mongod rejects every transaction.
+func requireReplicaSet(ctx context.Context, client *mongo.Client) error {
+	var hello struct {
+		SetName string `bson:"setName"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return fmt.Errorf("failed to run hello: %w", err)
+	}
+	if hello.SetName == "" {
+		return errors.New("MongoDB is not running as a replica set, but the worker needs transactions: " +
+			"start mongod with --replSet and run rs.initiate() (a single-node set is enough), " +
+			"or use the mongo service from docker-compose")
+	}
+	return nil
+}
+
+// ensureIndexes creates the indexes the worker relies on. CreateMany is a no-op
+// for indexes that already exist with the same definition.
+func ensureIndexes(ctx context.Context, db *mongo.Database) error {
+	return outbox.New(db, models.OutboxCollection).EnsureIndexes(ctx)
+}
@@ -0,0 +1,82 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Supported image formats (as reported by image.Decode)
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+)
+
+// MaxPixels bounds the width x height of decoded sources and of every resize output.
+// A decoded RGBA image takes 4 bytes per pixel, so this caps one image at 160 MB.
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned for images above MaxPixels.
+var ErrTooLarge = errors.New("image exceeds the maximum of 40 megapixels")
+
+// Decode decodes data and returns the image together with its format name.
+// Only JPEG, PNG and GIF are supported; their decoders are registered by the
+// imports above. GIF animations are reduced to their first frame.
+// The dimensions are read from the header first, so a small file that claims
+// a huge size is rejected before its pixels are allocated.
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if err := checkPixels(cfg.Width, cfg.Height); err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// checkPixels returns ErrTooLarge if a width x height image exceeds MaxPixels.
+func checkPixels(width, height int) error {
+	if width > 0 && height > 0 && width > MaxPixels/height {
+		return fmt.Errorf("%w (%dx%d)", ErrTooLarge, width, height)
+	}
+	return nil
+}
+
+// Encode writes img to w using the given format.
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	case FormatPNG:
+		return png.Encode(w, img)
+	case FormatGIF:
+		return gif.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// Extension returns the file extension (without dot) for a format.
+func Extension(format string) string {
+	if format == FormatJPEG {
+		return "jpg"
+	}
+	return format
+}
+
+// ContentType returns the MIME type for a format.
+func ContentType(format string) string {
+	return "image/" + format
+}
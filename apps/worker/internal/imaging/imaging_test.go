@@ -0,0 +1,189 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngHeader returns the signature and IHDR chunk of a PNG claiming width x height,
+// which is all image.DecodeConfig reads.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // Bit depth
+	ihdr[13] = 6 // Color type RGBA
+
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&b, binary.BigEndian, uint32(13))
+	b.Write(ihdr)
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return b.Bytes()
+}
+
+func TestDecodeRejectsOversizedSources(t *testing.T) {
+	_, _, err := Decode(pngHeader(50000, 50000))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Decode(50000x50000 header) error = %v, want ErrTooLarge", err)
+	}
+
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := Decode(small.Bytes())
+	if err != nil || format != FormatPNG || img.Bounds().Dx() != 4 {
+		t.Fatalf("Decode(4x3 png) = %v, %q, %v", img.Bounds(), format, err)
+	}
+}
+
+func TestResizeChecksOutputPixels(t *testing.T) {
+	// A 10000x1 strip resized to height 5000 would derive a 50000000x5000 output
+	strip := image.NewRGBA(image.Rect(0, 0, 10000, 1))
+	if _, err := Resize(strip, 0, 5000); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Resize(0, 5000) error = %v, want ErrTooLarge", err)
+	}
+	if _, err := Resize(strip, 10000, 10000); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Resize(10000, 10000) error = %v, want ErrTooLarge", err)
+	}
+
+	out, err := Resize(strip, 0, 2)
+	if err != nil || out.Bounds().Dx() != 20000 || out.Bounds().Dy() != 2 {
+		t.Fatalf("Resize(0, 2) = %v, %v, want 20000x2", out.Bounds(), err)
+	}
+}
+
+// gradient returns a w x h image whose pixel (x, y) has red x and green y,
+// so every output pixel tells where it came from.
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+	return img
+}
+
+// origin returns the source coordinates encoded in the pixel of img at (x, y).
+func origin(img image.Image, x, y int) image.Point {
+	c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	return image.Pt(int(c.R), int(c.G))
+}
+
+func TestCrop(t *testing.T) {
+	src := gradient(4, 3)
+	out, err := Crop(src, 1, 1, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Bounds() != image.Rect(0, 0, 3, 2) || origin(out, 0, 0) != image.Pt(1, 1) || origin(out, 2, 1) != image.Pt(3, 2) {
+		t.Errorf("Crop(1, 1, 3, 2) = %v starting at %v", out.Bounds(), origin(out, 0, 0))
+	}
+
+	for _, r := range []image.Rectangle{
+		image.Rect(2, 0, 5, 3),  // Past the right edge
+		image.Rect(0, 1, 4, 4),  // Past the bottom edge
+		image.Rect(-1, 0, 2, 2), // Negative offset
+		image.Rect(0, 0, 0, 3),  // Empty
+		image.Rect(4, 3, 5, 4),  // Entirely outside
+		image.Rect(0, 0, 4, 3),  // Whole image: allowed
+	} {
+		_, err := Crop(src, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+		if inside := r.Dx() > 0 && r.Dy() > 0 && r.In(src.Bounds()); (err == nil) != inside {
+			t.Errorf("Crop(%v) error = %v, want error %v", r, err, !inside)
+		}
+	}
+
+	// Offsets are relative to the image, even if its bounds do not start at (0, 0)
+	sub := src.SubImage(image.Rect(1, 1, 4, 3))
+	out, err = Crop(sub, 1, 0, 2, 2)
+	if err != nil || origin(out, 0, 0) != image.Pt(2, 1) {
+		t.Errorf("Crop of a sub-image = %v, %v, want it to start at (2, 1)", err, origin(out, 0, 0))
+	}
+}
+
+func TestRotate(t *testing.T) {
+	src := gradient(4, 3)
+	tests := []struct {
+		angle   int
+		bounds  image.Rectangle
+		topLeft image.Point // Source pixel that ends up at (0, 0)
+	}{
+		{0, image.Rect(0, 0, 4, 3), image.Pt(0, 0)},
+		{90, image.Rect(0, 0, 3, 4), image.Pt(0, 2)},
+		{180, image.Rect(0, 0, 4, 3), image.Pt(3, 2)},
+		{270, image.Rect(0, 0, 3, 4), image.Pt(3, 0)},
+		{-90, image.Rect(0, 0, 3, 4), image.Pt(3, 0)},
+		{450, image.Rect(0, 0, 3, 4), image.Pt(0, 2)},
+	}
+	for _, tt := range tests {
+		out, err := Rotate(src, tt.angle)
+		if err != nil {
+			t.Fatalf("Rotate(%d): %v", tt.angle, err)
+		}
+		if out.Bounds() != tt.bounds || origin(out, 0, 0) != tt.topLeft {
+			t.Errorf("Rotate(%d) = %v with (0, 0) from %v, want %v from %v",
+				tt.angle, out.Bounds(), origin(out, 0, 0), tt.bounds, tt.topLeft)
+		}
+	}
+
+	if _, err := Rotate(src, 45); err == nil {
+		t.Error("Rotate(45) accepted")
+	}
+}
+
+func TestFlip(t *testing.T) {
+	src := gradient(4, 3)
+	tests := []struct {
+		direction string
+		topLeft   image.Point
+	}{
+		{"horizontal", image.Pt(3, 0)},
+		{"vertical", image.Pt(0, 2)},
+	}
+	for _, tt := range tests {
+		out, err := Flip(src, tt.direction)
+		if err != nil {
+			t.Fatalf("Flip(%s): %v", tt.direction, err)
+		}
+		if out.Bounds() != src.Bounds() || origin(out, 0, 0) != tt.topLeft {
+			t.Errorf("Flip(%s) = %v with (0, 0) from %v, want %v from %v",
+				tt.direction, out.Bounds(), origin(out, 0, 0), src.Bounds(), tt.topLeft)
+		}
+	}
+
+	if _, err := Flip(src, "diagonal"); err == nil {
+		t.Error("Flip(diagonal) accepted")
+	}
+}
+
+func TestGrayscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+	src.Set(1, 0, color.White)
+
+	out := Grayscale(src)
+	gray, ok := out.(*image.Gray)
+	if !ok {
+		t.Fatalf("Grayscale returned %T, want *image.Gray", out)
+	}
+	if gray.Bounds() != src.Bounds() {
+		t.Errorf("Grayscale bounds = %v, want %v", gray.Bounds(), src.Bounds())
+	}
+	// Luma of pure red is about 30%
+	if y := gray.GrayAt(0, 0).Y; y < 70 || y > 80 {
+		t.Errorf("gray level of red = %d, want about 76", y)
+	}
+	if y := gray.GrayAt(1, 0).Y; y != 255 {
+		t.Errorf("gray level of white = %d, want 255", y)
+	}
+}
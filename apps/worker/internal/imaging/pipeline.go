@@ -0,0 +1,67 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/sanjain/pixelflow/pkg/events"
+)
+
+// Supported operation names
+const (
+	OpResize    = "resize"
+	OpCrop      = "crop"
+	OpRotate    = "rotate"
+	OpFlip      = "flip"
+	OpGrayscale = "grayscale"
+)
+
+// Operation describes a single transformation step.
+// Only the parameters relevant to Op are used.
+type Operation struct {
+	Op        string `bson:"op" json:"op"`
+	Width     int    `bson:"width,omitempty" json:"width,omitempty"`
+	Height    int    `bson:"height,omitempty" json:"height,omitempty"`
+	X         int    `bson:"x,omitempty" json:"x,omitempty"`
+	Y         int    `bson:"y,omitempty" json:"y,omitempty"`
+	Angle     int    `bson:"angle,omitempty" json:"angle,omitempty"`
+	Direction string `bson:"direction,omitempty" json:"direction,omitempty"`
+}
+
+// DefaultOperations is what the API stores when a request specifies no operations
+// (the shared events.DefaultOperations). Tasks created before operations existed
+// have none stored and get these too.
+var DefaultOperations = func() []Operation {
+	ops := make([]Operation, len(events.DefaultOperations))
+	for i, op := range events.DefaultOperations {
+		ops[i] = Operation(op)
+	}
+	return ops
+}()
+
+// Apply runs the operations against img in order and returns the result.
+// The first failing step aborts the pipeline.
+func Apply(img image.Image, ops []Operation) (image.Image, error) {
+	var err error
+	for i, op := range ops {
+		switch op.Op {
+		case OpResize:
+			img, err = Resize(img, op.Width, op.Height)
+		case OpCrop:
+			img, err = Crop(img, op.X, op.Y, op.Width, op.Height)
+		case OpRotate:
+			img, err = Rotate(img, op.Angle)
+		case OpFlip:
+			img, err = Flip(img, op.Direction)
+		case OpGrayscale:
+			img = Grayscale(img)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Op)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i, op.Op, err)
+		}
+	}
+	return img, nil
+}
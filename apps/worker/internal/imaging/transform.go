@@ -0,0 +1,176 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Resize scales img to width x height using bilinear interpolation.
+// If one of the dimensions is 0, it is derived from the other to keep the aspect ratio.
+// The API bounds the requested dimensions; the derived one can still be large for
+// very wide or tall sources, so the output is checked against MaxPixels here.
+func Resize(img image.Image, width, height int) (image.Image, error) {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+
+	if width < 0 || height < 0 || (width == 0 && height == 0) {
+		return nil, errors.New("resize: width or height must be positive")
+	}
+	if width == 0 {
+		width = max(1, srcW*height/srcH)
+	}
+	if height == 0 {
+		height = max(1, srcH*width/srcW)
+	}
+	if err := checkPixels(width, height); err != nil {
+		return nil, fmt.Errorf("resize: %w", err)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	src := toRGBA(img)
+
+	// Map each destination pixel center back into source space
+	xRatio := float64(srcW) / float64(width)
+	yRatio := float64(srcH) / float64(height)
+
+	for y := 0; y < height; y++ {
+		sy := (float64(y)+0.5)*yRatio - 0.5
+		y0, y1, fy := neighbours(sy, srcH)
+
+		for x := 0; x < width; x++ {
+			sx := (float64(x)+0.5)*xRatio - 0.5
+			x0, x1, fx := neighbours(sx, srcW)
+
+			c00 := src.RGBAAt(x0, y0)
+			c10 := src.RGBAAt(x1, y0)
+			c01 := src.RGBAAt(x0, y1)
+			c11 := src.RGBAAt(x1, y1)
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: lerp2(c00.R, c10.R, c01.R, c11.R, fx, fy),
+				G: lerp2(c00.G, c10.G, c01.G, c11.G, fx, fy),
+				B: lerp2(c00.B, c10.B, c01.B, c11.B, fx, fy),
+				A: lerp2(c00.A, c10.A, c01.A, c11.A, fx, fy),
+			})
+		}
+	}
+
+	return dst, nil
+}
+
+// Crop returns the width x height region whose top-left corner is (x, y).
+func Crop(img image.Image, x, y, width, height int) (image.Image, error) {
+	b := img.Bounds()
+	rect := image.Rect(x, y, x+width, y+height).Add(b.Min)
+
+	if width <= 0 || height <= 0 || !rect.In(b) {
+		return nil, fmt.Errorf("crop: region %v is outside image bounds %v", rect, b)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst, nil
+}
+
+// Rotate rotates img clockwise by the given angle (multiples of 90 only).
+func Rotate(img image.Image, angle int) (image.Image, error) {
+	angle = ((angle % 360) + 360) % 360
+	if angle%90 != 0 {
+		return nil, fmt.Errorf("rotate: angle must be a multiple of 90, got %d", angle)
+	}
+	if angle == 0 {
+		return img, nil
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var dst *image.RGBA
+	if angle == 180 {
+		dst = image.NewRGBA(image.Rect(0, 0, w, h))
+	} else {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			switch angle {
+			case 90:
+				dst.Set(h-1-y, x, c)
+			case 180:
+				dst.Set(w-1-x, h-1-y, c)
+			case 270:
+				dst.Set(y, w-1-x, c)
+			}
+		}
+	}
+
+	return dst, nil
+}
+
+// Flip mirrors img horizontally or vertically.
+func Flip(img image.Image, direction string) (image.Image, error) {
+	if direction != "horizontal" && direction != "vertical" {
+		return nil, fmt.Errorf("flip: direction must be 'horizontal' or 'vertical', got %q", direction)
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			if direction == "horizontal" {
+				dst.Set(w-1-x, y, c)
+			} else {
+				dst.Set(x, h-1-y, c)
+			}
+		}
+	}
+
+	return dst, nil
+}
+
+// Grayscale converts img to 8-bit grayscale.
+func Grayscale(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// toRGBA returns img as *image.RGBA with bounds starting at (0, 0).
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// neighbours returns the two source indices surrounding coordinate v and the
+// interpolation weight between them, clamped to [0, size-1].
+func neighbours(v float64, size int) (int, int, float64) {
+	if v < 0 {
+		v = 0
+	}
+	i0 := int(v)
+	if i0 >= size-1 {
+		return size - 1, size - 1, 0
+	}
+	return i0, i0 + 1, v - float64(i0)
+}
+
+// lerp2 performs bilinear interpolation between four channel values.
+func lerp2(c00, c10, c01, c11 uint8, fx, fy float64) uint8 {
+	top := float64(c00)*(1-fx) + float64(c10)*fx
+	bottom := float64(c01)*(1-fx) + float64(c11)*fx
+	return uint8(top*(1-fy) + bottom*fy + 0.5)
+}
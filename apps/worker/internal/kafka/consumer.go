@@ -2,32 +2,78 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/sanjain/pixelflow/apps/worker/internal/metrics"
+	"github.com/sanjain/pixelflow/pkg/events"
 	"github.com/segmentio/kafka-go"
 )
 
-// TaskEvent represents the message received from Kafka.
+// Message headers used by the retry / dead-letter flow
+const (
+	HeaderRetryCount    = "x-retry-count"
+	HeaderError         = "x-error"
+	HeaderOriginalTopic = "x-original-topic"
+	HeaderFailedAt      = "x-failed-at"
+	HeaderNotBefore     = "x-not-before" // RFC 3339 time before which a retry must not run
+)
+
+// DefaultMaxDelayed is how many retries that are not due yet each worker sets aside
+// before it stops taking new messages.
+const DefaultMaxDelayed = 100
+
+// RetryPolicy controls how failed messages are retried before being dead-lettered.
+type RetryPolicy struct {
+	MaxRetries     int           // Retries after the first attempt (0 = dead-letter immediately)
+	InitialBackoff time.Duration // Delay before the first retry, doubled on each subsequent one
+	MaxBackoff     time.Duration // Upper bound for the delay
+
+	// Retryable reports whether an error is worth retrying.
+	// Errors it rejects are dead-lettered straight away. nil means "retry everything".
+	Retryable func(error) bool
+}
+
+// Backoff returns the delay before retry number attempt (1-based).
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// TaskEvent represents the message received from Kafka:
+// the shared, versioned event contract plus the Kafka headers (trace context, retry count).
 type TaskEvent struct {
-	TaskID      string         `json:"task_id"`
-	UserID      string         `json:"user_id"`
-	OriginalURL string         `json:"original_url"`
-	Headers     []kafka.Header `json:"-"`
+	events.TaskEvent
+	Headers []kafka.Header
 }
 
 // Consumer handles reading messages from Kafka.
 type Consumer struct {
-	reader *kafka.Reader
+	reader      *kafka.Reader
+	writer      *kafka.Writer // Republishes retries and writes dead letters
+	topic       string
+	dlqTopic    string
+	concurrency int
+	maxDelayed  int // Retries each worker sets aside at most (see work)
+	policy      RetryPolicy
 }
 
 // NewConsumer creates a new Kafka consumer.
 // brokers: List of Kafka broker addresses
 // topic: Topic to consume from
 // groupID: Consumer group ID (for load balancing)
-func NewConsumer(brokers []string, topic, groupID string) *Consumer {
+// concurrency: Number of messages processed in parallel
+// policy: Retry policy; exhausted messages go to "<topic>.dlq"
+func NewConsumer(brokers []string, topic, groupID string, concurrency int, policy RetryPolicy) *Consumer {
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     brokers,
 		Topic:       topic,
@@ -35,24 +81,155 @@ func NewConsumer(brokers []string, topic, groupID string) *Consumer {
 		GroupID:     groupID,
 	})
 
+	// Topic is set per message so one writer serves both the retry and DLQ topics
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Balancer:               &kafka.Hash{}, // Keep the task ID -> partition mapping stable
+		AllowAutoTopicCreation: true,
+	}
+
 	fmt.Printf("Kafka Consumer initialized for topic: %s (Group: %s)\n", topic, groupID)
-	return &Consumer{reader: reader}
+	return &Consumer{
+		reader:      reader,
+		writer:      writer,
+		topic:       topic,
+		dlqTopic:    topic + ".dlq",
+		concurrency: max(1, concurrency),
+		maxDelayed:  DefaultMaxDelayed,
+		policy:      policy,
+	}
 }
 
 // Consume starts the consumer loop.
-// handler: A function that processes each received task.
+// handler: A function that processes each received task. It is called from
+// several goroutines at once (see concurrency) and must be safe for that.
+// onDeadLetter: Called after a message has been moved to the DLQ (e.g., to mark the task FAILED).
+//
+// Messages are spread over a bounded pool of workers. Messages with the same key
+// (task ID) always go to the same worker, so retries of a task stay in order.
+// Retries are republished at once with a not-before time; a worker that receives
+// one early sets it aside and keeps processing other messages until it is due.
+//
+// Offsets are committed manually, only once a message has been fully dealt with:
+// processed successfully, republished for retry, or moved to the DLQ. Since workers
+// finish out of order, a partition is only committed up to its oldest in-flight
+// message. A crash in between leaves the offset uncommitted and the message is
+// redelivered, so the handler must be idempotent.
+//
+// Consume returns when ctx is cancelled, after the workers have stopped and all
+// finished offsets have been committed.
 //
 // IMPORTANT: This function implements retry logic to handle Kafka connection failures.
 // Common scenario: Worker starts before Kafka is fully ready during docker-compose startup.
 // Instead of crashing on first error, we log and continue trying to read messages.
-func (c *Consumer) Consume(ctx context.Context, handler func(TaskEvent) error) {
-	fmt.Println("Worker started consuming messages...")
+func (c *Consumer) Consume(ctx context.Context, handler func(TaskEvent) error, onDeadLetter func(TaskEvent, error)) {
+	fmt.Printf("Worker started consuming messages (concurrency: %d)...\n", c.concurrency)
+
+	tracker := newOffsetTracker()
+	commits := make(chan kafka.Message, c.concurrency)
+	committerDone := make(chan struct{})
+	go func() {
+		c.commitLoop(commits)
+		close(committerDone)
+	}()
+
+	// Start Worker Pool
+	// Each worker has a one-slot queue and sets aside at most maxDelayed retries, so at
+	// most (2 + maxDelayed) x concurrency messages are in flight
+	var wg sync.WaitGroup
+	queues := make([]chan kafka.Message, c.concurrency)
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, 1)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			c.work(ctx, queue, tracker, commits, handler, onDeadLetter)
+		}(queues[i])
+	}
+
+	c.fetchLoop(ctx, tracker, queues)
+
+	// Drain: let workers finish their current message, then flush the last commits
+	for _, queue := range queues {
+		close(queue)
+	}
+	wg.Wait()
+	close(commits)
+	<-committerDone
+}
+
+// work processes the messages of one worker queue until it is closed. Retries that
+// are not due yet wait in a local list ordered by due time, so they do not hold up
+// the messages behind them. They stay in flight (uncommitted) while they wait, and
+// are redelivered if the worker shuts down first. Once maxDelayed retries are waiting,
+// the worker stops reading its queue until the first one is due; the fetch loop then
+// blocks on the full queue, which bounds the memory held by waiting retries.
+func (c *Consumer) work(ctx context.Context, queue <-chan kafka.Message, tracker *offsetTracker, commits chan<- kafka.Message, handler func(TaskEvent) error, onDeadLetter func(TaskEvent, error)) {
+	var delayed []kafka.Message
+	timer := time.NewTimer(time.Hour) // Armed only while messages are delayed
+	timer.Stop()
+
+	process := func(m kafka.Message) {
+		if ctx.Err() != nil {
+			// Shutting down: release messages that have not started yet
+			return
+		}
+		if !c.handle(ctx, m, handler, onDeadLetter) {
+			// Interrupted by shutdown; leave the offset uncommitted for redelivery
+			return
+		}
+		if commit, ok := tracker.complete(m); ok {
+			commits <- commit
+		}
+	}
 
 	for {
-		// 1. Read Message
-		// Note: ReadMessage blocks until a message is available or an error occurs
-		m, err := c.reader.ReadMessage(ctx)
+		var due <-chan time.Time
+		if len(delayed) > 0 {
+			timer.Reset(time.Until(notBefore(delayed[0].Headers)))
+			due = timer.C
+		}
+		incoming := queue
+		if len(delayed) >= c.maxDelayed {
+			incoming = nil // Full: wait for the first retry to be due
+		}
+
+		select {
+		case <-ctx.Done():
+			// Shutting down: delayed retries are left uncommitted for redelivery
+			return
+		case m, ok := <-incoming:
+			if !ok {
+				return
+			}
+			if notBefore(m.Headers).After(time.Now()) {
+				i, _ := slices.BinarySearchFunc(delayed, notBefore(m.Headers), func(d kafka.Message, t time.Time) int {
+					return notBefore(d.Headers).Compare(t)
+				})
+				delayed = slices.Insert(delayed, i, m)
+				continue
+			}
+			process(m)
+		case <-due:
+			m := delayed[0]
+			delayed = delayed[1:]
+			process(m)
+		}
+		timer.Stop()
+	}
+}
+
+// fetchLoop reads messages and dispatches them to the worker queues until ctx is cancelled.
+func (c *Consumer) fetchLoop(ctx context.Context, tracker *offsetTracker, queues []chan kafka.Message) {
+	for {
+		// 1. Fetch Message
+		// Note: FetchMessage blocks until a message is available or an error occurs.
+		// Unlike ReadMessage it does not commit the offset.
+		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			// CHANGED: Instead of breaking (which exits the loop), we log and continue
 			// This handles temporary Kafka connection issues during startup
 			// Example: Worker starts at T+0s, Kafka ready at T+6s
@@ -62,22 +239,176 @@ func (c *Consumer) Consume(ctx context.Context, handler func(TaskEvent) error) {
 			continue // Keep trying instead of breaking
 		}
 
-		// 2. Parse Message
-		var event TaskEvent
-		if err := json.Unmarshal(m.Value, &event); err != nil {
-			slog.Warn("Failed to unmarshal event", "error", err)
-			continue // Skip malformed messages
+		tracker.add(m)
+
+		// Same key -> same worker, preserving per-task ordering
+		h := fnv.New32a()
+		h.Write(m.Key)
+		queue := queues[h.Sum32()%uint32(len(queues))]
+
+		select {
+		case queue <- m:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// commitLoop commits the offsets it receives, skipping any that would move a
+// partition backwards (commits from different workers may arrive out of order).
+func (c *Consumer) commitLoop(commits <-chan kafka.Message) {
+	committed := make(map[int]int64)
+	for m := range commits {
+		if last, ok := committed[m.Partition]; ok && m.Offset <= last {
+			continue
+		}
+
+		// 4. Commit Offset
+		// Background context: commits must still go through while shutting down
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := c.reader.CommitMessages(ctx, m)
+		cancel()
+		if err != nil {
+			// The message will be redelivered after a restart/rebalance; the handler is idempotent
+			slog.Error("Failed to commit offset", "partition", m.Partition, "offset", m.Offset, "error", err)
+			continue
+		}
+		committed[m.Partition] = m.Offset
+	}
+}
+
+// handle decodes and processes one message, routing failures to retry or the DLQ.
+// It reports whether the message reached a final outcome and may be committed.
+func (c *Consumer) handle(ctx context.Context, m kafka.Message, handler func(TaskEvent) error, onDeadLetter func(TaskEvent, error)) bool {
+	// 2. Parse Message
+	// Older schema versions are upgraded; malformed or unknown versions cannot be
+	// processed by this worker, so they go straight to the DLQ for inspection
+	decoded, err := events.DecodeTaskEvent(m.Value)
+	if err != nil {
+		slog.Warn("Failed to decode event", "offset", m.Offset, "error", err)
+		return c.deadLetter(ctx, m, err, retryCount(m.Headers))
+	}
+	event := TaskEvent{TaskEvent: decoded, Headers: m.Headers}
+
+	fmt.Printf("Received task: %s\n", event.TaskID)
+
+	// 3. Process Message (Call the handler)
+	if err := handler(event); err != nil {
+		slog.Error("Failed to process task", "task_id", event.TaskID, "error", err)
+		return c.handleFailure(ctx, m, event, err, onDeadLetter)
+	}
+	return true
+}
+
+// handleFailure republishes a failed message with an incremented retry count,
+// or moves it to the DLQ once retries are exhausted or the error is not retryable.
+// It reports false only if ctx was cancelled before either happened.
+func (c *Consumer) handleFailure(ctx context.Context, m kafka.Message, event TaskEvent, cause error, onDeadLetter func(TaskEvent, error)) bool {
+	retries := retryCount(m.Headers)
+	retryable := c.policy.Retryable == nil || c.policy.Retryable(cause)
+
+	if retryable && retries < c.policy.MaxRetries {
+		attempt := retries + 1
+		backoff := c.policy.Backoff(attempt)
+		slog.Warn("Retrying task", "task_id", event.TaskID, "attempt", attempt, "max_retries", c.policy.MaxRetries, "backoff", backoff.String())
+
+		// Republish now, due after the backoff so transient failures (e.g., a Mongo blip)
+		// have time to clear. Waiting here would stall every task behind this one.
+		headers := withHeader(m.Headers, HeaderRetryCount, strconv.Itoa(attempt))
+		headers = withHeader(headers, HeaderError, cause.Error())
+		headers = withHeader(headers, HeaderNotBefore, time.Now().Add(backoff).UTC().Format(time.RFC3339Nano))
+		err := c.publish(ctx, c.topic, m, headers)
+		if err == nil {
+			metrics.KafkaRetriesTotal.Inc()
+			return true
+		}
+
+		// Fall through to the DLQ so the message is not silently lost
+		slog.Error("Failed to republish task for retry", "task_id", event.TaskID, "error", err)
+	}
+
+	if !c.deadLetter(ctx, m, cause, retries) {
+		return false
+	}
+
+	if onDeadLetter != nil {
+		onDeadLetter(event, cause)
+	}
+	return true
+}
+
+// deadLetter publishes m to the DLQ with the failure reason attached.
+// The offset must not be committed before the DLQ has the message, so publishing
+// is retried until it succeeds; it reports false only if ctx is cancelled first.
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, cause error, retries int) bool {
+	headers := withHeader(m.Headers, HeaderRetryCount, strconv.Itoa(retries))
+	headers = withHeader(headers, HeaderError, cause.Error())
+	headers = withHeader(headers, HeaderOriginalTopic, m.Topic)
+	headers = withHeader(headers, HeaderFailedAt, time.Now().UTC().Format(time.RFC3339))
+
+	for attempt := 1; ; attempt++ {
+		err := c.publish(ctx, c.dlqTopic, m, headers)
+		if err == nil {
+			break
+		}
+		slog.Error("Failed to publish message to DLQ", "key", string(m.Key), "attempt", attempt, "error", err)
+
+		select {
+		case <-time.After(c.policy.Backoff(attempt)):
+		case <-ctx.Done():
+			return false
 		}
-		event.Headers = m.Headers
+	}
+
+	slog.Warn("Message moved to DLQ", "key", string(m.Key), "topic", c.dlqTopic, "retries", retries)
+	metrics.KafkaDeadLettersTotal.Inc()
+	return true
+}
 
-		fmt.Printf("Received task: %s\n", event.TaskID)
+// publish writes a copy of m to topic with the given headers.
+func (c *Consumer) publish(ctx context.Context, topic string, m kafka.Message, headers []kafka.Header) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-		// 3. Process Message (Call the handler)
-		if err := handler(event); err != nil {
-			slog.Error("Failed to process task", "task_id", event.TaskID, "error", err)
-			// Note: In a real app, we might want to retry or send to a Dead Letter Queue (DLQ)
+	return c.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+}
+
+// retryCount reads the retry counter from the message headers (0 if absent).
+func retryCount(headers []kafka.Header) int {
+	for _, h := range headers {
+		if h.Key == HeaderRetryCount {
+			n, _ := strconv.Atoi(string(h.Value))
+			return n
+		}
+	}
+	return 0
+}
+
+// notBefore reads the time before which a retry must not run (zero if absent or invalid).
+func notBefore(headers []kafka.Header) time.Time {
+	for _, h := range headers {
+		if h.Key == HeaderNotBefore {
+			t, _ := time.Parse(time.RFC3339Nano, string(h.Value))
+			return t
 		}
 	}
+	return time.Time{}
+}
+
+// withHeader returns a copy of headers with key set to value.
+func withHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	out := make([]kafka.Header, 0, len(headers)+1)
+	for _, h := range headers {
+		if h.Key != key {
+			out = append(out, h)
+		}
+	}
+	return append(out, kafka.Header{Key: key, Value: []byte(value)})
 }
 
 // Close closes the consumer connection.
@@ -85,4 +416,7 @@ func (c *Consumer) Close() {
 	if err := c.reader.Close(); err != nil {
 		log.Printf("Failed to close Kafka reader: %v", err)
 	}
+	if err := c.writer.Close(); err != nil {
+		log.Printf("Failed to close Kafka writer: %v", err)
+	}
 }
@@ -0,0 +1,155 @@
+package kafka
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/segmentio/kafka-go"
+)
+
+// TestConsumerDecodesAPITaskEvents feeds the API's encoded task event (pinned by
+// the API's tests) through the consumer.
+func TestConsumerDecodesAPITaskEvents(t *testing.T) {
+	payload, err := os.ReadFile("../../../../pkg/events/testdata/task_event.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []TaskEvent
+	c := &Consumer{}
+	done := c.handle(context.Background(), kafka.Message{Value: payload}, func(e TaskEvent) error {
+		got = append(got, e)
+		return nil
+	}, nil)
+
+	if !done || len(got) != 1 {
+		t.Fatalf("handle() = %v with %d handler calls, want true with 1", done, len(got))
+	}
+	want := events.TaskEvent{
+		SchemaVersion: events.TaskEventVersion,
+		TaskID:        "652f1c0e8b3e4a0001a1b2c3",
+		UserID:        "42",
+		ImageURL:      "https://example.com/cat.jpg",
+		OriginalKey:   "originals/652f1c0e8b3e4a0001a1b2c3.jpg",
+		Operations: []events.Operation{
+			{Op: "resize", Width: 800},
+			{Op: "crop", X: 10, Y: 20, Width: 100, Height: 50},
+			{Op: "flip", Direction: "horizontal"},
+		},
+	}
+	if !reflect.DeepEqual(got[0].TaskEvent, want) {
+		t.Errorf("decoded event = %+v, want %+v", got[0].TaskEvent, want)
+	}
+}
+
+// TestWorkDoesNotBlockOnDelayedRetries checks that a retry received before its
+// not-before time waits aside while the messages behind it are processed.
+func TestWorkDoesNotBlockOnDelayedRetries(t *testing.T) {
+	message := func(offset int64, taskID string, due time.Time) kafka.Message {
+		m := kafka.Message{Offset: offset, Value: []byte(`{"schema_version":1,"task_id":"` + taskID + `"}`)}
+		if !due.IsZero() {
+			m.Headers = withHeader(nil, HeaderNotBefore, due.UTC().Format(time.RFC3339Nano))
+		}
+		return m
+	}
+	now := time.Now()
+	msgs := []kafka.Message{
+		message(0, "retry", now.Add(200*time.Millisecond)),
+		message(1, "fresh", time.Time{}),
+		message(2, "overdue", now.Add(-time.Second)),
+	}
+
+	tracker := newOffsetTracker()
+	queue := make(chan kafka.Message, len(msgs))
+	for _, m := range msgs {
+		tracker.add(m)
+		queue <- m
+	}
+	commits := make(chan kafka.Message, len(msgs))
+
+	var order []string
+	var retryRanAt time.Time
+	done := make(chan struct{})
+	go func() {
+		(&Consumer{maxDelayed: DefaultMaxDelayed}).work(context.Background(), queue, tracker, commits, func(e TaskEvent) error {
+			order = append(order, e.TaskID)
+			if e.TaskID == "retry" {
+				retryRanAt = time.Now()
+				close(queue)
+			}
+			return nil
+		}, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("work did not finish")
+	}
+	if want := []string{"fresh", "overdue", "retry"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("processing order = %v, want %v", order, want)
+	}
+	if retryRanAt.Before(now.Add(200 * time.Millisecond)) {
+		t.Errorf("retry ran %v before it was due", now.Add(200*time.Millisecond).Sub(retryRanAt))
+	}
+	close(commits)
+	var last int64 = -1
+	for m := range commits {
+		last = m.Offset
+	}
+	if last != 2 {
+		t.Errorf("last committed offset = %d, want 2", last)
+	}
+}
+
+// TestWorkCapsDelayedRetries checks that a worker stops reading its queue once
+// maxDelayed retries are waiting, and resumes when one of them is due.
+func TestWorkCapsDelayedRetries(t *testing.T) {
+	due := time.Now().Add(300 * time.Millisecond)
+	msgs := []kafka.Message{
+		{Offset: 0, Value: []byte(`{"schema_version":1,"task_id":"retry"}`),
+			Headers: withHeader(nil, HeaderNotBefore, due.UTC().Format(time.RFC3339Nano))},
+		{Offset: 1, Value: []byte(`{"schema_version":1,"task_id":"fresh"}`)},
+	}
+
+	tracker := newOffsetTracker()
+	queue := make(chan kafka.Message, len(msgs))
+	for _, m := range msgs {
+		tracker.add(m)
+		queue <- m
+	}
+	commits := make(chan kafka.Message, len(msgs))
+
+	var order []string
+	done := make(chan struct{})
+	go func() {
+		(&Consumer{maxDelayed: 1}).work(context.Background(), queue, tracker, commits, func(e TaskEvent) error {
+			order = append(order, e.TaskID)
+			if len(order) == len(msgs) {
+				close(queue)
+			}
+			return nil
+		}, nil)
+		close(done)
+	}()
+
+	// The fresh message stays queued while the retry fills the delayed list
+	time.Sleep(100 * time.Millisecond)
+	if len(queue) != 1 {
+		t.Fatalf("%d messages queued while the delayed list is full, want 1", len(queue))
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("work did not finish")
+	}
+	if want := []string{"retry", "fresh"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("processing order = %v, want %v", order, want)
+	}
+}
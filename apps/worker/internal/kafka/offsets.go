@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker tracks in-flight messages per partition so that, with several
+// workers finishing out of order, only offsets below the oldest unfinished
+// message are ever committed.
+type offsetTracker struct {
+	mu       sync.Mutex
+	inFlight map[int][]int64                 // partition -> fetched offsets, oldest first
+	done     map[int]map[int64]kafka.Message // partition -> finished, not yet committable
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		inFlight: make(map[int][]int64),
+		done:     make(map[int]map[int64]kafka.Message),
+	}
+}
+
+// add registers a fetched message. Messages of a partition must be added in offset order.
+func (t *offsetTracker) add(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.inFlight[m.Partition] = append(t.inFlight[m.Partition], m.Offset)
+}
+
+// complete marks m as finished and returns the newest message that can now be
+// committed, i.e. the end of the finished run at the head of its partition.
+// ok is false if an older message of the partition is still in flight.
+func (t *offsetTracker) complete(m kafka.Message) (commit kafka.Message, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	done := t.done[m.Partition]
+	if done == nil {
+		done = make(map[int64]kafka.Message)
+		t.done[m.Partition] = done
+	}
+	done[m.Offset] = m
+
+	queue := t.inFlight[m.Partition]
+	for len(queue) > 0 {
+		head, finished := done[queue[0]]
+		if !finished {
+			break
+		}
+		delete(done, queue[0])
+		queue = queue[1:]
+		commit, ok = head, true
+	}
+	t.inFlight[m.Partition] = queue
+
+	return commit, ok
+}
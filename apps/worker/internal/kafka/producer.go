@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/worker/internal/metrics"
+	"github.com/segmentio/kafka-go"
+)
+
+// Producer publishes task lifecycle events from the outbox.
+type Producer struct {
+	writer *kafka.Writer
+}
+
+// NewProducer creates a producer for the lifecycle events topic.
+// brokers: List of Kafka broker addresses (e.g., ["localhost:9092"])
+// topic: The topic to write to (e.g., "task-events")
+func NewProducer(brokers []string, topic string) *Producer {
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{}, // Same task -> same partition, so its events stay ordered
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}
+
+	fmt.Printf("Kafka Producer initialized for topic: %s\n", topic)
+	return &Producer{writer: writer}
+}
+
+// PublishMessage sends an encoded lifecycle event keyed by task ID (see outbox.Relay).
+// headers: Trace context captured when the event was written, so consumers can
+// continue the trace that started at the API
+func (p *Producer) PublishMessage(ctx context.Context, key string, value []byte, headers map[string]string) error {
+	kafkaHeaders := make([]kafka.Header, 0, len(headers))
+	for k, v := range headers {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: k, Value: []byte(v)})
+	}
+
+	// Write message with a timeout
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(key),
+		Value:   value,
+		Headers: kafkaHeaders,
+	})
+	if err != nil {
+		metrics.TaskEventsPublishErrorsTotal.Inc()
+		return fmt.Errorf("failed to publish task event: %w", err)
+	}
+
+	metrics.TaskEventsPublishedTotal.WithLabelValues(eventStatus(value)).Inc()
+	return nil
+}
+
+// eventStatus returns the status of an encoded lifecycle event, for metric labels.
+func eventStatus(value []byte) string {
+	var e struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(value, &e); err != nil || e.Status == "" {
+		return "unknown"
+	}
+	return e.Status
+}
+
+// Close closes the producer connection.
+func (p *Producer) Close() {
+	if err := p.writer.Close(); err != nil {
+		log.Printf("Failed to close Kafka writer: %v", err)
+	}
+}
@@ -44,4 +44,33 @@ var (
 			Help: "Total number of errors when consuming from Kafka",
 		},
 	)
+
+	KafkaRetriesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "worker_kafka_retries_total",
+			Help: "Total number of failed messages republished for retry",
+		},
+	)
+
+	KafkaDeadLettersTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "worker_kafka_dead_letters_total",
+			Help: "Total number of messages moved to the dead-letter topic",
+		},
+	)
+
+	TaskEventsPublishedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_task_events_published_total",
+			Help: "Total number of task lifecycle events published to task-events",
+		},
+		[]string{"status"},
+	)
+
+	TaskEventsPublishErrorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "worker_task_events_publish_errors_total",
+			Help: "Total number of failed attempts to publish task lifecycle events (they stay in the outbox and are retried)",
+		},
+	)
 )
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/sanjain/pixelflow/apps/worker/internal/imaging"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,15 +15,29 @@ const (
 	StatusProcessing TaskStatus = "PROCESSING"
 	StatusCompleted  TaskStatus = "COMPLETED"
 	StatusFailed     TaskStatus = "FAILED"
+	StatusCancelled  TaskStatus = "CANCELLED" // Set by the API; the worker must not process the task
 )
 
+// IsTerminal reports whether no further processing should happen for the status.
+func (s TaskStatus) IsTerminal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// OutboxCollection holds the worker's lifecycle events until the relay publishes them.
+// It is separate from the API's "outbox", so neither relay claims the other's messages.
+const OutboxCollection = "worker_outbox"
+
 // Task represents an image processing task
 type Task struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	UserID       string             `bson:"user_id" json:"user_id"`
-	ImageURL     string             `bson:"image_url" json:"image_url"`
-	ProcessedURL string             `bson:"processed_url,omitempty" json:"processed_url,omitempty"`
-	Status       TaskStatus         `bson:"status" json:"status"`
-	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"_id,omitempty"`
+	UserID       string              `bson:"user_id" json:"user_id"`
+	ImageURL     string              `bson:"image_url" json:"image_url"`
+	OriginalKey  string              `bson:"original_key,omitempty" json:"original_key,omitempty"` // Storage key of an uploaded original
+	Operations   []imaging.Operation `bson:"operations" json:"operations"`
+	ProcessedKey string              `bson:"processed_key,omitempty" json:"processed_key,omitempty"` // Storage key of the output
+	ProcessedURL string              `bson:"processed_url,omitempty" json:"processed_url,omitempty"`
+	Error        string              `bson:"error,omitempty" json:"error,omitempty"` // Failure reason when Status is FAILED
+	Status       TaskStatus          `bson:"status" json:"status"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time           `bson:"updated_at" json:"updated_at"`
 }
@@ -1,72 +1,359 @@
 package processor
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net/http"
 	"time"
 
+	"github.com/sanjain/pixelflow/apps/worker/internal/imaging"
 	"github.com/sanjain/pixelflow/apps/worker/internal/models"
+	"github.com/sanjain/pixelflow/pkg/events"
+	"github.com/sanjain/pixelflow/pkg/outbox"
+	"github.com/sanjain/pixelflow/pkg/safehttp"
+	"github.com/sanjain/pixelflow/pkg/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	// maxImageBytes caps the size of a downloaded source image (20 MB)
+	maxImageBytes = 20 << 20
+
+	// processedURLExpiry is the lifetime of the signed URL stored on the task.
+	// The API re-signs processed_key on read, so this only matters for direct consumers.
+	processedURLExpiry = 7 * 24 * time.Hour
+)
+
+// ErrPermanent matches (via errors.Is) failures that retrying cannot fix,
+// such as an invalid task, an unreachable (404) source or an undecodable image.
+var ErrPermanent = errors.New("permanent failure")
+
+// permanentError wraps an error so it matches ErrPermanent without changing its message.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string        { return e.err.Error() }
+func (e permanentError) Unwrap() error        { return e.err }
+func (e permanentError) Is(target error) bool { return target == ErrPermanent }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
 // Processor handles the image processing logic.
 type Processor struct {
+	db             *mongo.Database
 	taskCollection *mongo.Collection
+	httpClient     *http.Client
+	allowPrivate   bool
+	blob           storage.Blob
+	outbox         *outbox.Outbox
+	relay          *outbox.Relay
 }
 
 // NewProcessor creates a new processor instance.
-func NewProcessor(db *mongo.Database) *Processor {
+// blob: Object storage where processed images are written
+// relay: Publishes the lifecycle event written to the outbox with every status change (PROCESSING, COMPLETED, FAILED)
+// allowPrivate: Download from loopback and private addresses too (local development only)
+func NewProcessor(db *mongo.Database, blob storage.Blob, relay *outbox.Relay, allowPrivate bool) *Processor {
 	return &Processor{
+		db:             db,
 		taskCollection: db.Collection("tasks"),
+		// Source URLs come from users: connections to internal addresses (MongoDB,
+		// Redis, MinIO, cloud metadata) are refused at dial time, after DNS resolution
+		httpClient:   safehttp.NewClient(safehttp.Config{Timeout: 30 * time.Second, AllowPrivate: allowPrivate}),
+		allowPrivate: allowPrivate,
+		blob:         blob,
+		outbox:       outbox.New(db, models.OutboxCollection),
+		relay:        relay,
 	}
 }
 
-// ProcessImage simulates image processing and updates the task status.
-func (p *Processor) ProcessImage(taskID string) error {
-	ctx := context.Background()
-	objID, _ := primitive.ObjectIDFromHex(taskID)
+// ProcessImage downloads the task's source image, runs the task's operation
+// list and stores the result, updating the task status along the way.
+// Errors matching ErrPermanent will fail again on retry; all others may be transient.
+// The caller decides when to give up and call MarkFailed.
+// Cancelling ctx aborts the task midway; it stays PROCESSING and resumes on redelivery.
+//
+// ProcessImage is idempotent, so redelivered messages are safe: tasks that already
+// reached a terminal state (including CANCELLED by the user) are skipped, status changes are conditional on the
+// current status, and the output key is derived from the task ID.
+func (p *Processor) ProcessImage(ctx context.Context, taskID string) error {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return permanent(fmt.Errorf("invalid task id %q: %w", taskID, err))
+	}
+
+	// 1. Load Task
+	var task models.Task
+	if err := p.taskCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&task); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return permanent(fmt.Errorf("task %s not found", taskID))
+		}
+		return fmt.Errorf("failed to load task %s: %w", taskID, err)
+	}
+	if task.Status.IsTerminal() {
+		slog.Info("Skipping task in terminal state", "task_id", taskID, "status", task.Status)
+		return nil
+	}
 
-	// 1. Update Status to PROCESSING
-	p.updateStatus(ctx, objID, models.StatusProcessing, "")
+	// 2. Update Status to PROCESSING
+	// PROCESSING -> PROCESSING is allowed so a task interrupted by a crash can resume
+	started := time.Now()
+	_, ok, err := p.transition(ctx, objID, []models.TaskStatus{models.StatusPending, models.StatusProcessing}, models.StatusProcessing, nil,
+		func(e *events.TaskLifecycleEvent) {
+			e.StartedAt = &started
+		})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slog.Info("Skipping task claimed or finished concurrently", "task_id", taskID)
+		return nil
+	}
 	fmt.Printf("Processing task: %s...\n", taskID)
 
-	// 2. Simulate Processing (Sleep)
-	time.Sleep(5 * time.Second)
+	// 3. Fetch, Transform and Store
+	processedKey, err := p.transform(ctx, task)
+	if err != nil {
+		return err
+	}
 
-	// 3. Generate "Processed" URL
-	processedURL := fmt.Sprintf("https://cdn.pixelflow.com/processed/%s.jpg", taskID)
+	processedURL, err := p.blob.SignedURL(ctx, processedKey, processedURLExpiry)
+	if err != nil {
+		return err
+	}
 
 	// 4. Update Status to COMPLETED
-	err := p.updateStatus(ctx, objID, models.StatusCompleted, processedURL)
+	_, ok, err = p.transition(ctx, objID, []models.TaskStatus{models.StatusProcessing}, models.StatusCompleted, bson.M{
+		"processed_key": processedKey,
+		"processed_url": processedURL,
+	}, func(e *events.TaskLifecycleEvent) {
+		e.StartedAt = &started
+		e.DurationMs = time.Since(started).Milliseconds()
+	})
 	if err != nil {
 		return err
 	}
+	if !ok {
+		// Most likely cancelled while processing; drop the orphaned output
+		slog.Info("Task left PROCESSING before completion; result discarded", "task_id", taskID)
+		if err := p.blob.Delete(ctx, processedKey); err != nil {
+			slog.Warn("Failed to delete discarded output", "task_id", taskID, "key", processedKey, "error", err)
+		}
+		return nil
+	}
 
 	fmt.Printf("Task %s completed!\n", taskID)
 	return nil
 }
 
-// updateStatus helper to update MongoDB document.
-func (p *Processor) updateStatus(ctx context.Context, id primitive.ObjectID, status models.TaskStatus, url string) error {
-	update := bson.M{
-		"$set": bson.M{
-			"status":     status,
-			"updated_at": time.Now(),
-		},
+// transform runs the fetch -> decode -> apply -> encode -> store pipeline
+// and returns the storage key of the processed image.
+func (p *Processor) transform(ctx context.Context, task models.Task) (string, error) {
+	body, err := p.loadSource(ctx, task)
+	if err != nil {
+		return "", err
+	}
+
+	img, format, err := imaging.Decode(body)
+	if err != nil {
+		return "", permanent(err)
+	}
+
+	// Operations run in the order they were submitted
+	img, err = imaging.Apply(img, operations(task))
+	if err != nil {
+		return "", permanent(err)
+	}
+
+	var out bytes.Buffer
+	if err := imaging.Encode(&out, img, format); err != nil {
+		return "", permanent(fmt.Errorf("failed to encode image: %w", err))
+	}
+
+	key := fmt.Sprintf("processed/%s.%s", task.ID.Hex(), imaging.Extension(format))
+	if err := p.blob.Put(ctx, key, &out, int64(out.Len()), imaging.ContentType(format)); err != nil {
+		return "", fmt.Errorf("failed to store processed image: %w", err)
+	}
+
+	return key, nil
+}
+
+// operations returns the task's pipeline. Legacy tasks stored without operations
+// get the API's default, rather than an empty pipeline that copies the image unchanged.
+func operations(task models.Task) []imaging.Operation {
+	if len(task.Operations) == 0 {
+		return imaging.DefaultOperations
+	}
+	return task.Operations
+}
+
+// loadSource reads uploaded originals from storage and downloads everything else.
+func (p *Processor) loadSource(ctx context.Context, task models.Task) ([]byte, error) {
+	if task.OriginalKey == "" {
+		return p.fetch(ctx, task.ImageURL)
+	}
+
+	r, err := p.blob.Get(ctx, task.OriginalKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, permanent(fmt.Errorf("original %s not found", task.OriginalKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load original: %w", err)
+	}
+	defer r.Close()
+
+	body, err := io.ReadAll(io.LimitReader(r, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original: %w", err)
+	}
+	if len(body) > maxImageBytes {
+		return nil, permanent(fmt.Errorf("image exceeds maximum size of %d bytes", maxImageBytes))
+	}
+	return body, nil
+}
+
+// fetch downloads the source image, refusing anything larger than maxImageBytes.
+func (p *Processor) fetch(ctx context.Context, url string) ([]byte, error) {
+	if err := safehttp.CheckURL(url, p.allowPrivate); err != nil {
+		return nil, permanent(fmt.Errorf("invalid image url: %w", err))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, permanent(fmt.Errorf("invalid image url: %w", err))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if errors.Is(err, safehttp.ErrBlockedAddress) {
+		// Same message whether or not anything listens there, so it reveals nothing about the network
+		return nil, permanent(errors.New("failed to download image: " + safehttp.ErrBlockedAddress.Error()))
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
 
-	// If URL is provided, update it too
-	if url != "" {
-		update["$set"].(bson.M)["processed_url"] = url
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("failed to download image: unexpected status %d", resp.StatusCode)
+		// Server errors and throttling may clear up; other client errors will not
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, err
+		}
+		return nil, permanent(err)
 	}
 
-	_, err := p.taskCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(body) > maxImageBytes {
+		return nil, permanent(fmt.Errorf("image exceeds maximum size of %d bytes", maxImageBytes))
+	}
+	return body, nil
+}
+
+// transition moves a task from one of the from statuses to status, setting extra
+// fields alongside it (extra may be nil). It returns the updated task and reports
+// whether it was updated; false means the task was not in any of the from statuses.
+//
+// The status change and its lifecycle event (written to the outbox) are stored in one
+// transaction, so every status change is published even if Kafka is down or the
+// worker dies right after. annotate may add attempt details to the event (or be nil).
+func (p *Processor) transition(ctx context.Context, id primitive.ObjectID, from []models.TaskStatus, status models.TaskStatus, extra bson.M, annotate func(*events.TaskLifecycleEvent)) (models.Task, bool, error) {
+	set := bson.M{
+		"status":     status,
+		"updated_at": time.Now(),
+	}
+	for k, v := range extra {
+		set[k] = v
+	}
+	update := bson.M{"$set": set}
+	filter := bson.M{"_id": id, "status": bson.M{"$in": from}}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	session, err := p.db.Client().StartSession()
+	if err != nil {
+		return models.Task{}, false, fmt.Errorf("failed to start session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	var task models.Task
+	updated := false
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		updated = false
+		err := p.taskCollection.FindOneAndUpdate(sc, filter, update, opts).Decode(&task)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		event := lifecycleEvent(task)
+		if annotate != nil {
+			annotate(&event)
+		}
+		msg, err := lifecycleMessage(sc, event)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.outbox.Insert(sc, msg); err != nil {
+			return nil, err
+		}
+		updated = true
+		return nil, nil
+	})
 	if err != nil {
 		log.Printf("Failed to update status for %s: %v", id.Hex(), err)
-		return err
+		return task, false, err
 	}
-	return nil
+	if updated {
+		// Publish right away instead of waiting for the next poll
+		p.relay.Notify()
+	}
+	return task, updated, nil
+}
+
+// lifecycleMessage builds the outbox message that publishes event to "task-events",
+// keyed by task ID so one task's events land on the same partition.
+func lifecycleMessage(ctx context.Context, event events.TaskLifecycleEvent) (outbox.Message, error) {
+	payload, err := events.EncodeTaskLifecycleEvent(event)
+	if err != nil {
+		return outbox.Message{}, fmt.Errorf("failed to encode task event: %w", err)
+	}
+	return outbox.NewMessage(ctx, events.TopicTaskEvents, event.TaskID, payload), nil
+}
+
+// lifecycleEvent describes the task's current status.
+func lifecycleEvent(task models.Task) events.TaskLifecycleEvent {
+	return events.TaskLifecycleEvent{
+		TaskID:       task.ID.Hex(),
+		UserID:       task.UserID,
+		Status:       string(task.Status),
+		OccurredAt:   task.UpdatedAt,
+		CreatedAt:    task.CreatedAt,
+		ProcessedKey: task.ProcessedKey,
+		ProcessedURL: task.ProcessedURL,
+		Error:        task.Error,
+	}
+}
+
+// MarkFailed sets the task status to FAILED and records the failure reason.
+// Tasks that already reached a terminal state are left untouched.
+func (p *Processor) MarkFailed(ctx context.Context, taskID string, reason error) error {
+	objID, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		return fmt.Errorf("invalid task id %q: %w", taskID, err)
+	}
+	_, _, err = p.transition(ctx, objID, []models.TaskStatus{models.StatusPending, models.StatusProcessing}, models.StatusFailed, bson.M{"error": reason.Error()}, nil)
+	return err
 }
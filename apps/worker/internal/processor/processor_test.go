@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sanjain/pixelflow/apps/worker/internal/imaging"
+	"github.com/sanjain/pixelflow/apps/worker/internal/models"
+	"github.com/sanjain/pixelflow/pkg/events"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden event files")
+
+// lifecycleEventGolden is the worker's encoded TaskLifecycleEvent; the API's tests decode it.
+const lifecycleEventGolden = "../../../../pkg/events/testdata/task_lifecycle_event.json"
+
+// TestLifecycleMessageMatchesGolden pins the bytes the worker publishes to "task-events".
+// Run with -update after an intentional contract change, then run the API's tests.
+func TestLifecycleMessageMatchesGolden(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("652f1c0e8b3e4a0001a1b2c3")
+	task := models.Task{
+		ID:           id,
+		UserID:       "42",
+		Status:       models.StatusCompleted,
+		ProcessedKey: "processed/652f1c0e8b3e4a0001a1b2c3.jpg",
+		ProcessedURL: "https://storage.example.com/processed/652f1c0e8b3e4a0001a1b2c3.jpg?sig=abc",
+		CreatedAt:    time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedAt:    time.Date(2024, 10, 1, 12, 0, 3, 0, time.UTC),
+	}
+	started := time.Date(2024, 10, 1, 12, 0, 1, 0, time.UTC)
+	event := lifecycleEvent(task)
+	event.StartedAt = &started
+	event.DurationMs = 2000
+
+	msg, err := lifecycleMessage(context.Background(), event)
+	if err != nil {
+		t.Fatalf("lifecycleMessage: %v", err)
+	}
+	if msg.Topic != events.TopicTaskEvents || msg.Key != task.ID.Hex() {
+		t.Errorf("message topic/key = %s/%s, want %s/%s", msg.Topic, msg.Key, events.TopicTaskEvents, task.ID.Hex())
+	}
+
+	if *update {
+		if err := os.WriteFile(lifecycleEventGolden, append(msg.Payload, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(lifecycleEventGolden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Payload, bytes.TrimSpace(want)) {
+		t.Errorf("payload = %s\nwant (%s) = %s", msg.Payload, lifecycleEventGolden, want)
+	}
+}
+
+func TestOperationsFallsBackToDefault(t *testing.T) {
+	if got := operations(models.Task{}); !reflect.DeepEqual(got, imaging.DefaultOperations) {
+		t.Errorf("operations(legacy task) = %v, want %v", got, imaging.DefaultOperations)
+	}
+
+	ops := []imaging.Operation{{Op: imaging.OpGrayscale}}
+	if got := operations(models.Task{Operations: ops}); !reflect.DeepEqual(got, ops) {
+		t.Errorf("operations(task) = %v, want %v", got, ops)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/sanjain/pixelflow/pkg/events
+
+go 1.23.0
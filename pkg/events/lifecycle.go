@@ -0,0 +1,68 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TopicTaskEvents is the topic the worker publishes TaskLifecycleEvents to.
+const TopicTaskEvents = "task-events"
+
+// TaskLifecycleEventVersion is the current schema version of TaskLifecycleEvent.
+//
+//	1: Initial version.
+const TaskLifecycleEventVersion = 1
+
+// Task statuses reported by TaskLifecycleEvent
+const (
+	StatusProcessing = "PROCESSING"
+	StatusCompleted  = "COMPLETED"
+	StatusFailed     = "FAILED"
+)
+
+// TaskLifecycleEvent is published to the "task-events" topic by the worker every time
+// it moves a task to a new status. Messages are keyed by task ID, so the events of one
+// task arrive in order. A task may report PROCESSING more than once if it is retried.
+type TaskLifecycleEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	TaskID        string    `json:"task_id"`
+	UserID        string    `json:"user_id"`
+	Status        string    `json:"status"`
+	OccurredAt    time.Time `json:"occurred_at"` // When the status changed
+	CreatedAt     time.Time `json:"created_at"`  // When the task was submitted
+
+	// Timing of the current processing attempt (PROCESSING and COMPLETED)
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	DurationMs int64      `json:"duration_ms,omitempty"` // COMPLETED only
+
+	// Output location (COMPLETED only)
+	ProcessedKey string `json:"processed_key,omitempty"`
+	ProcessedURL string `json:"processed_url,omitempty"` // Signed; may expire before it is read
+
+	// Failure details (FAILED only)
+	Error string `json:"error,omitempty"`
+}
+
+// EncodeTaskLifecycleEvent serializes e, stamping the current schema version.
+func EncodeTaskLifecycleEvent(e TaskLifecycleEvent) ([]byte, error) {
+	e.SchemaVersion = TaskLifecycleEventVersion
+	return json.Marshal(e)
+}
+
+// DecodeTaskLifecycleEvent parses a TaskLifecycleEvent of any supported version.
+func DecodeTaskLifecycleEvent(data []byte) (TaskLifecycleEvent, error) {
+	var e TaskLifecycleEvent
+	if err := json.Unmarshal(data, &e); err != nil {
+		return TaskLifecycleEvent{}, fmt.Errorf("events: malformed task lifecycle event: %w", err)
+	}
+
+	if e.SchemaVersion != TaskLifecycleEventVersion {
+		return TaskLifecycleEvent{}, fmt.Errorf("%w: task lifecycle event version %d (max %d)", ErrUnsupportedVersion, e.SchemaVersion, TaskLifecycleEventVersion)
+	}
+	if e.TaskID == "" {
+		return TaskLifecycleEvent{}, errors.New("events: task lifecycle event is missing task_id")
+	}
+	return e, nil
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeTaskLifecycleEvent(t *testing.T) {
+	started := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	completed := TaskLifecycleEvent{
+		TaskID:       "652f1c0e8b3e4a0001a1b2c3",
+		UserID:       "42",
+		Status:       StatusCompleted,
+		OccurredAt:   started.Add(1500 * time.Millisecond),
+		CreatedAt:    started.Add(-time.Second),
+		StartedAt:    &started,
+		DurationMs:   1500,
+		ProcessedKey: "processed/652f1c0e8b3e4a0001a1b2c3.jpg",
+		ProcessedURL: "https://storage.example.com/processed/652f1c0e8b3e4a0001a1b2c3.jpg?sig=abc",
+	}
+	encoded, err := EncodeTaskLifecycleEvent(completed)
+	if err != nil {
+		t.Fatalf("EncodeTaskLifecycleEvent: %v", err)
+	}
+	want := completed
+	want.SchemaVersion = TaskLifecycleEventVersion
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    TaskLifecycleEvent
+		wantErr error
+	}{
+		{
+			name: "v1 round trip",
+			data: encoded,
+			want: want,
+		},
+		{
+			name: "v1 failure",
+			data: []byte(`{"schema_version":1,"task_id":"t1","user_id":"42","status":"FAILED","occurred_at":"2024-10-01T12:00:00Z","created_at":"2024-10-01T11:59:00Z","error":"decode: bad image"}`),
+			want: TaskLifecycleEvent{
+				SchemaVersion: 1,
+				TaskID:        "t1",
+				UserID:        "42",
+				Status:        StatusFailed,
+				OccurredAt:    time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC),
+				CreatedAt:     time.Date(2024, 10, 1, 11, 59, 0, 0, time.UTC),
+				Error:         "decode: bad image",
+			},
+		},
+		{
+			name:    "unknown schema_version is rejected",
+			data:    []byte(`{"schema_version":2,"task_id":"t1","status":"COMPLETED"}`),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "unversioned payload is rejected",
+			data:    []byte(`{"task_id":"t1","status":"COMPLETED"}`),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "missing task_id is rejected",
+			data:    []byte(`{"schema_version":1,"status":"COMPLETED"}`),
+			wantErr: errAny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeTaskLifecycleEvent(tt.data)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("DecodeTaskLifecycleEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeTaskLifecycleEvent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
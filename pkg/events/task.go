@@ -0,0 +1,87 @@
+// Package events defines the Kafka message contracts shared by the PixelFlow services.
+//
+// Every event carries a schema_version. Producers always write the current version;
+// consumers decode through the Decode* functions, which upgrade older versions and
+// reject versions they do not understand.
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// TaskEventVersion is the current schema version of TaskEvent.
+//
+//	0: Unversioned legacy payload. The API wrote "image_url", the worker expected "original_url".
+//	1: Adds schema_version, original_key and operations; the source is always "image_url".
+const TaskEventVersion = 1
+
+// ErrUnsupportedVersion is returned when an event's schema_version is newer than this decoder.
+var ErrUnsupportedVersion = errors.New("events: unsupported schema version")
+
+// Operation describes a single image transformation step.
+// Only the parameters relevant to Op are used.
+type Operation struct {
+	Op        string `json:"op"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	X         int    `json:"x,omitempty"`
+	Y         int    `json:"y,omitempty"`
+	Angle     int    `json:"angle,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// DefaultOperations is the pipeline of a task created without operations.
+// The API stores it with the task; the worker applies it to legacy tasks stored
+// before operations existed. It must not be modified.
+var DefaultOperations = []Operation{
+	{Op: "resize", Width: 800},
+}
+
+// TaskEvent is published to the "image-tasks" topic when a task is created.
+type TaskEvent struct {
+	SchemaVersion int         `json:"schema_version"`
+	TaskID        string      `json:"task_id"`
+	UserID        string      `json:"user_id"`
+	ImageURL      string      `json:"image_url"`
+	OriginalKey   string      `json:"original_key,omitempty"` // Set for direct file uploads
+	Operations    []Operation `json:"operations"`
+}
+
+// EncodeTaskEvent serializes e, stamping the current schema version.
+func EncodeTaskEvent(e TaskEvent) ([]byte, error) {
+	e.SchemaVersion = TaskEventVersion
+	return json.Marshal(e)
+}
+
+// DecodeTaskEvent parses a TaskEvent of any supported version and upgrades it to the current one.
+func DecodeTaskEvent(data []byte) (TaskEvent, error) {
+	// Decode into a superset of all versions' fields
+	var raw struct {
+		TaskEvent
+		OriginalURL string `json:"original_url"` // v0 (worker-side name)
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return TaskEvent{}, fmt.Errorf("events: malformed task event: %w", err)
+	}
+
+	e := raw.TaskEvent
+	switch e.SchemaVersion {
+	case 0:
+		if e.ImageURL == "" {
+			e.ImageURL = raw.OriginalURL
+		}
+	case TaskEventVersion:
+		// Current version
+	default:
+		return TaskEvent{}, fmt.Errorf("%w: task event version %d (max %d)", ErrUnsupportedVersion, e.SchemaVersion, TaskEventVersion)
+	}
+
+	if e.TaskID == "" {
+		return TaskEvent{}, errors.New("events: task event is missing task_id")
+	}
+
+	e.SchemaVersion = TaskEventVersion
+	return e, nil
+}
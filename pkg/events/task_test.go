@@ -0,0 +1,101 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeTaskEvent(t *testing.T) {
+	v1 := TaskEvent{
+		TaskID:      "652f1c0e8b3e4a0001a1b2c3",
+		UserID:      "42",
+		ImageURL:    "https://example.com/cat.jpg",
+		OriginalKey: "originals/652f1c0e8b3e4a0001a1b2c3.jpg",
+		Operations: []Operation{
+			{Op: "resize", Width: 800},
+			{Op: "crop", X: 10, Y: 20, Width: 100, Height: 50},
+			{Op: "flip", Direction: "horizontal"},
+		},
+	}
+	encoded, err := EncodeTaskEvent(v1)
+	if err != nil {
+		t.Fatalf("EncodeTaskEvent: %v", err)
+	}
+	wantV1 := v1
+	wantV1.SchemaVersion = TaskEventVersion
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    TaskEvent
+		wantErr error
+	}{
+		{
+			name: "v1 round trip",
+			data: encoded,
+			want: wantV1,
+		},
+		{
+			name: "v0 original_url is upgraded",
+			data: []byte(`{"task_id":"t1","user_id":"42","original_url":"https://example.com/old.png"}`),
+			want: TaskEvent{
+				SchemaVersion: TaskEventVersion,
+				TaskID:        "t1",
+				UserID:        "42",
+				ImageURL:      "https://example.com/old.png",
+			},
+		},
+		{
+			name: "v0 image_url is kept",
+			data: []byte(`{"task_id":"t1","user_id":"42","image_url":"https://example.com/api.png"}`),
+			want: TaskEvent{
+				SchemaVersion: TaskEventVersion,
+				TaskID:        "t1",
+				UserID:        "42",
+				ImageURL:      "https://example.com/api.png",
+			},
+		},
+		{
+			name:    "unknown schema_version is rejected",
+			data:    []byte(`{"schema_version":99,"task_id":"t1","image_url":"https://example.com/a.png"}`),
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "missing task_id is rejected",
+			data:    []byte(`{"schema_version":1,"image_url":"https://example.com/a.png"}`),
+			wantErr: errAny,
+		},
+		{
+			name:    "malformed JSON is rejected",
+			data:    []byte(`{"schema_version":`),
+			wantErr: errAny,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeTaskEvent(tt.data)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("DecodeTaskEvent() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeTaskEvent() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// errAny matches any non-nil error in table tests.
+var errAny = errors.New("any error")
+
+func matchErr(err, want error) bool {
+	switch want {
+	case nil:
+		return err == nil
+	case errAny:
+		return err != nil
+	default:
+		return errors.Is(err, want)
+	}
+}
@@ -0,0 +1,129 @@
+// Package jwks defines the JSON Web Key Set (RFC 7517) published by the auth service
+// at /.well-known/jwks.json and read by services that verify its tokens.
+//
+// Only signing keys used by PixelFlow are supported: RSA (RS256) and Ed25519 (EdDSA).
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Supported JWS algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// ErrUnsupportedKey is returned for key types or algorithms other than RS256 and EdDSA.
+var ErrUnsupportedKey = errors.New("jwks: unsupported key")
+
+// JWK is a public signing key.
+type JWK struct {
+	Kty string `json:"kty"` // RSA or OKP
+	Kid string `json:"kid"`
+	Use string `json:"use"` // Always "sig"
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// Set is the document served at /.well-known/jwks.json.
+type Set struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Lookup returns the key with the given kid.
+func (s Set) Lookup(kid string) (JWK, bool) {
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return JWK{}, false
+}
+
+// FromPublicKey builds the JWK for an RSA or Ed25519 public key.
+// The kid is the key's RFC 7638 thumbprint, so it is stable across restarts and replicas.
+func FromPublicKey(pub crypto.PublicKey) (JWK, error) {
+	var k JWK
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k = JWK{
+			Kty: "RSA",
+			Alg: AlgRS256,
+			N:   b64(pub.N.Bytes()),
+			E:   b64(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		k = JWK{
+			Kty: "OKP",
+			Alg: AlgEdDSA,
+			Crv: "Ed25519",
+			X:   b64(pub),
+		}
+	default:
+		return JWK{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+	k.Use = "sig"
+	k.Kid = k.Thumbprint()
+	return k, nil
+}
+
+// PublicKey decodes the key material into an *rsa.PublicKey or ed25519.PublicKey.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "RSA" && k.Alg == AlgRS256:
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: invalid exponent: %w", err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 || exp.Int64() < 3 {
+			return nil, errors.New("jwks: invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && k.Alg == AlgEdDSA:
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("jwks: invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("%w: kty=%s alg=%s", ErrUnsupportedKey, k.Kty, k.Alg)
+	}
+}
+
+// Thumbprint returns the RFC 7638 JWK thumbprint (base64url SHA-256 of the
+// required members in lexicographic order).
+func (k JWK) Thumbprint() string {
+	var canonical string
+	switch k.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,89 @@
+// Package outbox implements the transactional outbox shared by the API and the worker.
+//
+// A service writes each Kafka message into its outbox collection in the same
+// MongoDB transaction as the business change it describes, and a Relay publishes
+// it afterwards. A change can then never be stored without its message, or a
+// message published for a change that was rolled back.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// DefaultCollection is the API's outbox collection. Every service needs its own
+// collection, so no relay claims messages for topics it cannot publish.
+const DefaultCollection = "outbox"
+
+// sentRetention is how long published messages are kept for debugging.
+const sentRetention = 7 * 24 * time.Hour
+
+// Message is a Kafka message waiting to be published by the Relay.
+type Message struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Topic       string             `bson:"topic"`
+	Key         string             `bson:"key"`
+	Payload     []byte             `bson:"payload"`
+	Headers     map[string]string  `bson:"headers,omitempty"` // Trace context captured at write time
+	Attempts    int                `bson:"attempts"`
+	LastError   string             `bson:"last_error,omitempty"`
+	LockedUntil *time.Time         `bson:"locked_until,omitempty"` // Lease held by the relay publishing it
+	SentAt      *time.Time         `bson:"sent_at"`                // nil until published
+	ParkedAt    *time.Time         `bson:"parked_at,omitempty"`    // Set when no publisher handles Topic; no longer retried
+	CreatedAt   time.Time          `bson:"created_at"`
+}
+
+// NewMessage builds an outbox message for an encoded event, capturing the trace context from ctx.
+func NewMessage(ctx context.Context, topic, key string, payload []byte) Message {
+	// Inject Trace Context so the relay can continue the original trace
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return Message{
+		ID:        primitive.NewObjectID(),
+		Topic:     topic,
+		Key:       key,
+		Payload:   payload,
+		Headers:   carrier,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Outbox is one service's outbox collection.
+type Outbox struct {
+	collection *mongo.Collection
+}
+
+// New returns the outbox stored in the given collection of db.
+func New(db *mongo.Database, collection string) *Outbox {
+	return &Outbox{collection: db.Collection(collection)}
+}
+
+// Insert stores msg. Call it inside the same transaction (session context) as the
+// business write so both succeed or fail together.
+func (o *Outbox) Insert(ctx context.Context, msg Message) error {
+	_, err := o.collection.InsertOne(ctx, msg)
+	return err
+}
+
+// EnsureIndexes creates the indexes the relay relies on. CreateMany is a no-op
+// for indexes that already exist with the same definition.
+func (o *Outbox) EnsureIndexes(ctx context.Context) error {
+	_, err := o.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// Relay polling: oldest unsent message first
+		{Keys: bson.D{{Key: "sent_at", Value: 1}, {Key: "created_at", Value: 1}}},
+		// Sent messages are kept for a week for debugging, then removed
+		{
+			Keys:    bson.D{{Key: "sent_at", Value: 1}},
+			Options: options.Index().SetName("sent_at_ttl").SetExpireAfterSeconds(int32(sentRetention.Seconds())),
+		},
+	})
+	return err
+}
@@ -0,0 +1,174 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// leaseDuration is how long a relay owns a message before another relay may retry it
+const leaseDuration = 30 * time.Second
+
+// maxUnroutableAttempts is how often a message whose topic has no publisher is
+// claimed before it is parked. A newer replica may know the topic during a rolling
+// deploy, so the message is not parked on the first miss.
+const maxUnroutableAttempts = 10
+
+// Hooks let a service count relay outcomes in its own metrics. nil hooks are skipped.
+type Hooks struct {
+	Published     func() // A message was published
+	PublishFailed func() // Publishing failed; the message is retried
+	Parked        func() // A message was parked because no publisher handles its topic
+}
+
+// Publisher sends a raw message to Kafka.
+type Publisher interface {
+	PublishMessage(ctx context.Context, key string, value []byte, headers map[string]string) error
+}
+
+// Relay publishes pending outbox messages to Kafka and marks them sent.
+//
+// Delivery is at-least-once: if the process dies after publishing but before
+// marking the message sent, the lease expires and the message is published again.
+// Consumers must therefore be idempotent.
+type Relay struct {
+	collection *mongo.Collection
+	publishers map[string]Publisher // topic -> publisher
+	interval   time.Duration
+	hooks      Hooks
+	notify     chan struct{}
+}
+
+// NewRelay creates a relay that polls the outbox every interval.
+// publishers: One publisher per topic that may appear in the outbox
+// hooks: Called on each outcome, e.g. to update metrics
+func NewRelay(o *Outbox, publishers map[string]Publisher, interval time.Duration, hooks Hooks) *Relay {
+	return &Relay{
+		collection: o.collection,
+		publishers: publishers,
+		interval:   interval,
+		hooks:      hooks,
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the relay up without waiting for the next poll.
+// It never blocks; extra notifications are coalesced.
+func (r *Relay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes pending messages until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	slog.Info("Outbox relay started", "interval", r.interval.String())
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+	}
+}
+
+// drain publishes messages until none are pending.
+func (r *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		msg, err := r.claim(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return
+		}
+		if err != nil {
+			slog.Error("Outbox: Failed to claim message", "error", err)
+			return
+		}
+
+		if !r.publish(ctx, msg) {
+			// Kafka is likely unavailable; back off until the next poll
+			return
+		}
+	}
+}
+
+// claim atomically leases the oldest unsent message whose lease is free.
+func (r *Relay) claim(ctx context.Context) (Message, error) {
+	now := time.Now()
+	filter := bson.M{
+		"sent_at":   nil,
+		"parked_at": nil,
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"locked_until": now.Add(leaseDuration)},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var msg Message
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	return msg, err
+}
+
+// publish sends msg and records the outcome, reporting whether it was published.
+// On failure the lease is shortened so the next poll retries the message.
+func (r *Relay) publish(ctx context.Context, msg Message) bool {
+	publisher, ok := r.publishers[msg.Topic]
+	if !ok {
+		set := bson.M{"last_error": "no publisher for topic " + msg.Topic}
+		if msg.Attempts >= maxUnroutableAttempts {
+			// Stop claiming it; it stays in the outbox for inspection
+			set["parked_at"] = time.Now()
+			call(r.hooks.Parked)
+			slog.Error("Outbox: No publisher for topic, message parked", "topic", msg.Topic, "message_id", msg.ID.Hex(), "attempts", msg.Attempts)
+		} else {
+			slog.Error("Outbox: No publisher for topic", "topic", msg.Topic, "message_id", msg.ID.Hex(), "attempts", msg.Attempts)
+		}
+		r.collection.UpdateByID(ctx, msg.ID, bson.M{"$set": set})
+		return true // Not a Kafka problem; keep draining other messages
+	}
+
+	if err := publisher.PublishMessage(ctx, msg.Key, msg.Payload, msg.Headers); err != nil {
+		slog.Error("Outbox: Failed to publish message", "message_id", msg.ID.Hex(), "attempts", msg.Attempts, "error", err)
+		call(r.hooks.PublishFailed)
+		r.collection.UpdateByID(ctx, msg.ID, bson.M{"$set": bson.M{
+			"last_error":   err.Error(),
+			"locked_until": time.Now().Add(r.interval),
+		}})
+		return false
+	}
+
+	call(r.hooks.Published)
+
+	if _, err := r.collection.UpdateByID(ctx, msg.ID, bson.M{"$set": bson.M{"sent_at": time.Now()}}); err != nil {
+		// The lease will expire and the message will be published again (at-least-once)
+		slog.Error("Outbox: Failed to mark message sent", "message_id", msg.ID.Hex(), "error", err)
+		return true
+	}
+	slog.Info("Outbox: Message published", "message_id", msg.ID.Hex(), "topic", msg.Topic, "key", msg.Key)
+	return true
+}
+
+func call(hook func()) {
+	if hook != nil {
+		hook()
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/sanjain/pixelflow/pkg/safehttp
+
+go 1.23.0
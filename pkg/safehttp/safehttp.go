@@ -0,0 +1,123 @@
+// Package safehttp provides an HTTP client for requests to user-supplied URLs
+// (webhooks, source images) that cannot be pointed at internal services.
+//
+// The destination is checked when the connection is dialed, after DNS resolution,
+// so a hostname that resolves (or later re-resolves) to a private address is
+// refused as well. Redirects are checked the same way, since each hop is dialed.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned (wrapped) when a URL resolves to an address that
+// requests are not allowed to reach.
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+// blockedPrefixes are ranges not covered by the netip.Addr predicates used in Allowed
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can map to any IPv4 address
+}
+
+// Config configures a client.
+type Config struct {
+	Timeout time.Duration
+
+	// AllowPrivate disables the address check, e.g. for local development
+	// against receivers on localhost. Never enable it in production.
+	AllowPrivate bool
+}
+
+// Allowed reports whether requests may connect to addr: it must be a public
+// unicast address, not loopback, private (RFC 1918, fc00::/7), link-local
+// (including the 169.254.169.254 metadata endpoint), multicast or unspecified.
+func Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL checks that raw is an absolute http(s) URL. Hosts that are IP literals
+// are checked up front; hostnames are checked when the client dials them.
+func CheckURL(raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if allowPrivate {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !Allowed(addr) {
+		return fmt.Errorf("url host %s: %w", u.Hostname(), ErrBlockedAddress)
+	}
+	return nil
+}
+
+// NewClient creates an HTTP client that only connects to allowed addresses and
+// only follows redirects to http(s) URLs (at most 5).
+func NewClient(cfg Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !cfg.AllowPrivate {
+		dialer.Control = control
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil, // A proxy would be dialed instead of the destination, bypassing the check
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// control runs after DNS resolution, right before each connection is made.
+func control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%s: %w", address, ErrBlockedAddress)
+	}
+	if !Allowed(addrPort.Addr()) {
+		return fmt.Errorf("%s: %w", addrPort.Addr(), ErrBlockedAddress)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.5", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, tt := range tests {
+		if got := Allowed(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{"https://example.com/cat.jpg", false},
+		{"http://example.com:8080/hook", false},
+		{"ftp://example.com/cat.jpg", true},
+		{"file:///etc/passwd", true},
+		{"/relative/path", true},
+		{"http://127.0.0.1:6379/", true},
+		{"http://[::1]/", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://minio:9000/", false}, // Hostnames are checked at dial time
+	}
+	for _, tt := range tests {
+		if err := CheckURL(tt.url, false); (err != nil) != tt.wantErr {
+			t.Errorf("CheckURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestClientRefusesLoopbackAtDialTime(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	_, err := NewClient(Config{Timeout: time.Second}).Do(req)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("request to %s: error = %v, want ErrBlockedAddress", srv.URL, err)
+	}
+
+	resp, err := NewClient(Config{Timeout: time.Second, AllowPrivate: true}).Do(req)
+	if err != nil {
+		t.Fatalf("request with AllowPrivate: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in an S3-compatible bucket (AWS S3, MinIO, ...).
+type S3 struct {
+	client  *minio.Client
+	presign *minio.Client // Signs URLs for the public endpoint; may be client itself
+	bucket  string
+}
+
+// NewS3 connects to the configured endpoint and creates the bucket if it does not exist.
+func NewS3(ctx context.Context, cfg Config) (*S3, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return nil, errors.New("storage: s3 endpoint and bucket are required")
+	}
+
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to create s3 client: %w", err)
+	}
+
+	// The signature covers the host, so URLs for clients must be signed for the host they use.
+	// Signing is offline as long as the region is known; the public endpoint is never dialed.
+	presign := client
+	if cfg.S3PublicEndpoint != "" && cfg.S3PublicEndpoint != cfg.S3Endpoint {
+		if cfg.S3Region == "" {
+			return nil, errors.New("storage: s3 region is required with a public endpoint")
+		}
+		presign, err = minio.New(cfg.S3PublicEndpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+			Secure: cfg.S3PublicUseSSL,
+			Region: cfg.S3Region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("storage: failed to create s3 client for %s: %w", cfg.S3PublicEndpoint, err)
+		}
+	}
+
+	// Ensure the bucket exists (convenient for local MinIO setups)
+	exists, err := client.BucketExists(ctx, cfg.S3Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to check bucket %s: %w", cfg.S3Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.S3Bucket, minio.MakeBucketOptions{Region: cfg.S3Region}); err != nil {
+			return nil, fmt.Errorf("storage: failed to create bucket %s: %w", cfg.S3Bucket, err)
+		}
+	}
+
+	return &S3{client: client, presign: presign, bucket: cfg.S3Bucket}, nil
+}
+
+// Put uploads the object.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("storage: failed to put %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get downloads the object.
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("storage: failed to get %s: %w", key, err)
+	}
+
+	// GetObject is lazy; Stat forces the request so missing keys surface here
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("storage: failed to get %s: %w", key, err)
+	}
+	return obj, nil
+}
+
+// Delete removes the object.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("storage: failed to delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// SignedURL returns a presigned GET URL on the public endpoint.
+func (s *S3) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.presign.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("storage: failed to sign %s: %w", key, err)
+	}
+	return u.String(), nil
+}
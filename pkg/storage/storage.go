@@ -0,0 +1,111 @@
+// Package storage provides a pluggable object store used by the API (original
+// uploads) and the worker (processed outputs).
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrNotFound is returned when the requested object does not exist.
+var ErrNotFound = errors.New("storage: object not found")
+
+// Blob is the minimal object storage interface shared by all backends.
+// Keys are slash-separated paths such as "processed/<task_id>.jpg".
+type Blob interface {
+	// Put stores the contents of r under key. size may be -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the object stored under key. The caller must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the object stored under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// SignedURL returns a time-limited URL that grants read access to key.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Config selects and configures a backend.
+type Config struct {
+	Backend string // "local" or "s3"
+
+	// Local backend
+	LocalDir   string // Root directory for stored objects
+	PublicURL  string // Base URL under which the local handler is mounted
+	SigningKey string // Secret used to sign local URLs
+
+	// S3-compatible backend (AWS S3, MinIO, ...)
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+
+	// Endpoint put in presigned URLs, for when clients reach the store under a
+	// different address than the services do (e.g. "minio:9000" vs "localhost:9000").
+	// Defaults to S3Endpoint and S3UseSSL.
+	S3PublicEndpoint string
+	S3PublicUseSSL   bool
+}
+
+// New creates the backend described by cfg.
+func New(ctx context.Context, cfg Config) (Blob, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(cfg.LocalDir, cfg.PublicURL, cfg.SigningKey)
+	case "s3":
+		return NewS3(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Backend)
+	}
+}
+
+// devSigningKey signs local URLs when STORAGE_DEV=true and no key is set.
+const devSigningKey = "dev-storage-signing-key"
+
+// ConfigFromEnv builds a Config from the STORAGE_* and S3_* environment variables.
+//
+//	STORAGE_BACKEND      local (default) | s3
+//	STORAGE_LOCAL_DIR    root directory for the local backend
+//	STORAGE_PUBLIC_URL   base URL where the local backend's Handler is served
+//	STORAGE_SIGNING_KEY  secret for local signed URLs (required unless STORAGE_DEV=true)
+//	STORAGE_DEV          true: fall back to a fixed, publicly known signing key
+//	S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY, S3_USE_SSL
+//	S3_PUBLIC_ENDPOINT, S3_PUBLIC_USE_SSL  endpoint for presigned URLs (default: S3_ENDPOINT, S3_USE_SSL)
+func ConfigFromEnv() Config {
+	signingKey := getEnv("STORAGE_SIGNING_KEY", "")
+	if signingKey == "" && getEnv("STORAGE_DEV", "false") == "true" {
+		signingKey = devSigningKey
+	}
+	useSSL := getEnv("S3_USE_SSL", "false") == "true"
+
+	return Config{
+		Backend:          getEnv("STORAGE_BACKEND", "local"),
+		LocalDir:         getEnv("STORAGE_LOCAL_DIR", filepath.Join(os.TempDir(), "pixelflow-storage")),
+		PublicURL:        getEnv("STORAGE_PUBLIC_URL", "http://localhost:8080/files"),
+		SigningKey:       signingKey, // Empty fails NewLocal, so a deployment cannot forget it
+		S3Endpoint:       getEnv("S3_ENDPOINT", "localhost:9000"),
+		S3Region:         getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:         getEnv("S3_BUCKET", "pixelflow"),
+		S3AccessKey:      getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:      getEnv("S3_SECRET_KEY", ""),
+		S3UseSSL:         useSSL,
+		S3PublicEndpoint: getEnv("S3_PUBLIC_ENDPOINT", ""),
+		S3PublicUseSSL:   getEnv("S3_PUBLIC_USE_SSL", strconv.FormatBool(useSSL)) == "true",
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
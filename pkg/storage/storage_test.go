@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningKey = "test-signing-key"
+
+func newTestLocal(t *testing.T) (*Local, string) {
+	t.Helper()
+	dir := t.TempDir()
+	l, err := NewLocal(filepath.Join(dir, "objects"), "http://localhost:8080/files", testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, dir
+}
+
+func TestLocalRejectsTraversal(t *testing.T) {
+	l, dir := newTestLocal(t)
+	// A file next to the root that must stay out of reach
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"",
+		"/",
+		"../secret",
+		"originals/../../secret",
+		"originals/../x.jpg",
+		"/etc/passwd",
+		"originals//x.jpg",
+		"originals/./x.jpg",
+		"originals/x.jpg/",
+		"..",
+	} {
+		if _, err := l.path(key); err == nil {
+			t.Errorf("path(%q) accepted", key)
+		}
+		if err := l.Put(context.Background(), key, strings.NewReader("x"), 1, "image/jpeg"); err == nil {
+			t.Errorf("Put(%q) accepted", key)
+		}
+		if _, err := l.Get(context.Background(), key); err == nil {
+			t.Errorf("Get(%q) accepted", key)
+		}
+		if err := l.Delete(context.Background(), key); err == nil {
+			t.Errorf("Delete(%q) accepted", key)
+		}
+		if _, err := l.SignedURL(context.Background(), key, time.Minute); err == nil {
+			t.Errorf("SignedURL(%q) accepted", key)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "secret")); err != nil || string(data) != "secret" {
+		t.Fatalf("file outside the root changed: %q, %v", data, err)
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	l, _ := newTestLocal(t)
+	ctx := context.Background()
+	const key = "processed/abc/thumb.jpg"
+
+	if _, err := l.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Put: error = %v, want ErrNotFound", err)
+	}
+	if err := l.Put(ctx, key, strings.NewReader("jpeg bytes"), 10, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := l.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "jpeg bytes" {
+		t.Fatalf("Get = %q", data)
+	}
+	if err := l.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Delete(ctx, key); err != nil {
+		t.Fatalf("second Delete: %v", err)
+	}
+}
+
+func TestLocalHandlerVerifiesSignature(t *testing.T) {
+	l, _ := newTestLocal(t)
+	ctx := context.Background()
+	if err := l.Put(ctx, "originals/a.jpg", strings.NewReader("a"), 1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(ctx, "originals/b.jpg", strings.NewReader("b"), 1, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.StripPrefix("/files", l.Handler()))
+	defer server.Close()
+
+	// signed returns the path and query of a URL signed for key
+	signed := func(key string, expiry time.Duration) *url.URL {
+		raw, err := l.SignedURL(ctx, key, expiry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	valid := signed("originals/a.jpg", time.Minute)
+	other := signed("originals/b.jpg", time.Minute)
+
+	tests := []struct {
+		name   string
+		url    func() string
+		status int
+	}{
+		{"valid", func() string { return valid.RequestURI() }, http.StatusOK},
+		{"signature of another key", func() string {
+			return "/files/originals/b.jpg?" + valid.RawQuery
+		}, http.StatusForbidden},
+		{"tampered signature", func() string {
+			q := valid.Query()
+			q.Set("signature", strings.Repeat("0", 64))
+			return valid.Path + "?" + q.Encode()
+		}, http.StatusForbidden},
+		{"extended expiry", func() string {
+			q := valid.Query()
+			q.Set("expires", "9999999999")
+			return valid.Path + "?" + q.Encode()
+		}, http.StatusForbidden},
+		{"expired", func() string { return signed("originals/a.jpg", -time.Minute).RequestURI() }, http.StatusForbidden},
+		{"no signature", func() string { return valid.Path }, http.StatusForbidden},
+		{"signed with another key", func() string {
+			forged, err := NewLocal(t.TempDir(), "http://localhost:8080/files", "guessed-key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, _ := forged.SignedURL(ctx, "originals/a.jpg", time.Minute)
+			u, _ := url.Parse(raw)
+			return u.RequestURI()
+		}, http.StatusForbidden},
+		{"other valid URL", func() string { return other.RequestURI() }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + tt.url())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestNewLocalRequiresSigningKey(t *testing.T) {
+	if _, err := NewLocal(t.TempDir(), "http://localhost:8080/files", ""); err == nil {
+		t.Fatal("NewLocal accepted an empty signing key")
+	}
+}
+
+func TestConfigFromEnvSigningKey(t *testing.T) {
+	tests := []struct {
+		key, dev string
+		want     string
+	}{
+		{"", "", ""},
+		{"", "true", devSigningKey},
+		{"secret", "true", "secret"},
+		{"secret", "", "secret"},
+	}
+	for _, tt := range tests {
+		t.Setenv("STORAGE_SIGNING_KEY", tt.key)
+		t.Setenv("STORAGE_DEV", tt.dev)
+		if got := ConfigFromEnv().SigningKey; got != tt.want {
+			t.Errorf("STORAGE_SIGNING_KEY=%q STORAGE_DEV=%q: SigningKey = %q, want %q", tt.key, tt.dev, got, tt.want)
+		}
+	}
+}
+
+func TestS3SignsForPublicEndpoint(t *testing.T) {
+	// Stands in for the internal endpoint; only the bucket check reaches it
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer internal.Close()
+
+	s, err := NewS3(context.Background(), Config{
+		S3Endpoint:       strings.TrimPrefix(internal.URL, "http://"),
+		S3Region:         "us-east-1",
+		S3Bucket:         "pixelflow",
+		S3AccessKey:      "access",
+		S3SecretKey:      "secret",
+		S3PublicEndpoint: "cdn.example.com",
+		S3PublicUseSSL:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := s.SignedURL(context.Background(), "processed/abc.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "https" || u.Host != "cdn.example.com" || u.Path != "/pixelflow/processed/abc.jpg" {
+		t.Errorf("SignedURL = %s, want https://cdn.example.com/pixelflow/processed/abc.jpg", raw)
+	}
+	if u.Query().Get("X-Amz-Signature") == "" || u.Query().Get("X-Amz-Expires") != "60" {
+		t.Errorf("SignedURL = %s, want a presigned URL valid for 60s", raw)
+	}
+}
@@ -10,6 +10,7 @@ echo "=========================================="
 
 BASE_URL="http://localhost:8080"
 AUTH_URL="http://localhost:50051"
+MAILPIT_URL="http://localhost:8025"
 
 # Colors
 GREEN='\033[0;32m'
@@ -41,6 +42,21 @@ else
     exit 1
 fi
 
+# Verify the email with the link Mailpit caught (a no-op if the user already exists)
+if [[ $REGISTER_RESPONSE == *"successfully"* ]]; then
+    sleep 1
+    VERIFY_TOKEN=$(curl -s $MAILPIT_URL/api/v1/message/latest | grep -o 'verify-email?token=[A-Za-z0-9_-]*' | head -1 | sed 's/verify-email?token=//')
+    VERIFY_RESPONSE=$(curl -s -X POST $AUTH_URL/verify-email \
+        -H "Content-Type: application/json" \
+        -d "{\"token\":\"$VERIFY_TOKEN\"}")
+    if [[ $VERIFY_RESPONSE == *"Email verified"* ]]; then
+        echo -e "${GREEN}✓ Email Verification Successful${NC}"
+    else
+        echo -e "${RED}✗ Email Verification Failed: $VERIFY_RESPONSE${NC}"
+        exit 1
+    fi
+fi
+
 # Test 3: Login
 echo ""
 echo "📋 Test 3: Login User"
@@ -74,9 +90,11 @@ fi
 # Test 5: Upload Task (Authenticated)
 echo ""
 echo "📋 Test 5: Create Image Processing Task"
+IDEMPOTENCY_KEY="e2e-$(date +%s)-$RANDOM"
 UPLOAD_RESPONSE=$(curl -s -X POST $BASE_URL/api/upload \
     -H "Authorization: Bearer $TOKEN" \
     -H "Content-Type: application/json" \
+    -H "Idempotency-Key: $IDEMPOTENCY_KEY" \
     -d '{"image_url":"https://example.com/image.jpg"}')
 
 TASK_ID=$(echo $UPLOAD_RESPONSE | grep -o '"_id":"[^"]*' | sed 's/"_id":"//')
@@ -89,6 +107,32 @@ fi
 echo -e "${GREEN}✓ Task Created Successfully${NC}"
 echo "Task ID: $TASK_ID"
 
+# A retry with the same Idempotency-Key returns the same task
+RETRY_RESPONSE=$(curl -s -X POST $BASE_URL/api/upload \
+    -H "Authorization: Bearer $TOKEN" \
+    -H "Content-Type: application/json" \
+    -H "Idempotency-Key: $IDEMPOTENCY_KEY" \
+    -d '{"image_url":"https://example.com/image.jpg"}')
+RETRY_TASK_ID=$(echo $RETRY_RESPONSE | grep -o '"_id":"[^"]*' | sed 's/"_id":"//')
+
+if [ "$RETRY_TASK_ID" != "$TASK_ID" ]; then
+    echo -e "${RED}✗ Idempotent Retry Created Another Task: $RETRY_RESPONSE${NC}"
+    exit 1
+fi
+
+# ...and the same key with a different body is rejected
+CONFLICT_STATUS=$(curl -s -o /dev/null -w "%{http_code}" -X POST $BASE_URL/api/upload \
+    -H "Authorization: Bearer $TOKEN" \
+    -H "Content-Type: application/json" \
+    -H "Idempotency-Key: $IDEMPOTENCY_KEY" \
+    -d '{"image_url":"https://example.com/other.jpg"}')
+
+if [ "$CONFLICT_STATUS" != "409" ]; then
+    echo -e "${RED}✗ Reused Idempotency-Key Not Rejected (HTTP $CONFLICT_STATUS)${NC}"
+    exit 1
+fi
+echo -e "${GREEN}✓ Idempotent Retry Replayed the Same Task${NC}"
+
 # Test 6: List Tasks
 echo ""
 echo "📋 Test 6: List User Tasks"